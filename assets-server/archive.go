@@ -0,0 +1,478 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Policies for handling symbolic links when generating archives.
+const (
+	symlinksFollow   = "follow"
+	symlinksPreserve = "preserve"
+	symlinksDeny     = "deny"
+)
+
+// directoryWalker visits the files under a directory when generating archives,
+// skipping files excluded by .assetsignore files and applying the policy for
+// symbolic links. Nothing outside of the root directory is ever visited.
+//
+// With the follow policy, symbolic links are replaced by what they point at,
+// provided the target is within the root directory. With the preserve policy,
+// symbolic links are included as is, provided the target is within the
+// directory being archived, so the link still works when the archive is
+// unpacked. With the deny policy, symbolic links are always skipped.
+type directoryWalker struct {
+	rootDir  string
+	symlinks string
+}
+
+type walkFunc func(path string, relPath string, info os.FileInfo) error
+
+func newDirectoryWalker(rootDir string, symlinks string) (*directoryWalker, error) {
+	switch symlinks {
+	case symlinksFollow, symlinksPreserve, symlinksDeny:
+	default:
+		return nil, fmt.Errorf("invalid symlinks policy %q, must be follow, preserve or deny", symlinks)
+	}
+
+	return &directoryWalker{rootDir: rootDir, symlinks: symlinks}, nil
+}
+
+// resolve returns the path with symbolic links resolved, and checks whether
+// the path is allowed to be read under the policy for symbolic links.
+func (d *directoryWalker) resolve(targetPath string) (string, bool) {
+	rootDir, err := filepath.EvalSymlinks(d.rootDir)
+	if err != nil {
+		return "", false
+	}
+
+	relPath, err := filepath.Rel(d.rootDir, targetPath)
+	if err != nil || !isLocalPath(relPath) {
+		return "", false
+	}
+
+	resolvedPath, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		return "", false
+	}
+
+	if d.symlinks == symlinksDeny {
+		return resolvedPath, resolvedPath == filepath.Join(rootDir, relPath)
+	}
+
+	return resolvedPath, isWithinDirectory(rootDir, resolvedPath)
+}
+
+// walk calls fn for each file and directory under dirPath which is to be
+// included, including dirPath itself, passing the path of the entry relative
+// to dirPath in slash separated form.
+func (d *directoryWalker) walk(dirPath string, fn walkFunc) error {
+	resolvedDir, allowed := d.resolve(dirPath)
+	if !allowed {
+		return fmt.Errorf("directory %s is outside of the root directory", dirPath)
+	}
+
+	info, err := os.Stat(resolvedDir)
+	if err != nil {
+		return err
+	}
+
+	// Rules from ignore files in parent directories up to the root directory
+	// also apply to the directory being archived.
+
+	rootRelDir, _ := filepath.Rel(d.rootDir, dirPath)
+	rootRelDir = filepath.ToSlash(rootRelDir)
+
+	var rules []*ignoreRules
+
+	if rootRelDir != "." {
+		parentDir := d.rootDir
+		parentRelDir := "."
+
+		for _, component := range strings.Split(rootRelDir, "/") {
+			parentRules, err := loadIgnoreRules(parentDir, parentRelDir)
+			if err != nil {
+				return err
+			}
+
+			if parentRules != nil {
+				rules = append(rules, parentRules)
+			}
+
+			parentDir = filepath.Join(parentDir, component)
+			parentRelDir = path.Join(parentRelDir, component)
+		}
+	}
+
+	visited := map[string]bool{resolvedDir: true}
+
+	return d.walkDirectory(dirPath, resolvedDir, ".", rootRelDir, info, rules, visited, fn)
+}
+
+// isExcluded checks whether a slash separated path relative to the root
+// directory would be left out of archives, either because it matches ignore
+// rules or because one of its parent directories does.
+func (d *directoryWalker) isExcluded(rootRelPath string, isDir bool) bool {
+	var rules []*ignoreRules
+
+	parentDir := d.rootDir
+	parentRelDir := "."
+
+	components := strings.Split(rootRelPath, "/")
+
+	for i, component := range components {
+		if component == ignoreFileName || strings.HasPrefix(component, uploadStagingPrefix) {
+			return true
+		}
+
+		if parentRules, err := loadIgnoreRules(parentDir, parentRelDir); err == nil && parentRules != nil {
+			rules = append(rules, parentRules)
+		}
+
+		entryRelPath := path.Join(parentRelDir, component)
+
+		if isIgnored(rules, entryRelPath, isDir || i != len(components)-1) {
+			return true
+		}
+
+		parentDir = filepath.Join(parentDir, component)
+		parentRelDir = entryRelPath
+	}
+
+	return false
+}
+
+func (d *directoryWalker) walkDirectory(dirPath string, archiveDir string, relPath string, rootRelPath string, info os.FileInfo, rules []*ignoreRules, visited map[string]bool, fn walkFunc) error {
+	if err := fn(dirPath, relPath, info); err != nil {
+		return err
+	}
+
+	dirRules, err := loadIgnoreRules(dirPath, rootRelPath)
+	if err != nil {
+		return err
+	}
+
+	if dirRules != nil {
+		rules = append(rules[:len(rules):len(rules)], dirRules)
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// Skip the ignore file and any staging area of an upload which is
+		// still in progress.
+		if entry.Name() == ignoreFileName || strings.HasPrefix(entry.Name(), uploadStagingPrefix) {
+			continue
+		}
+
+		entryPath := filepath.Join(dirPath, entry.Name())
+		entryRelPath := path.Join(relPath, entry.Name())
+		entryRootRelPath := path.Join(rootRelPath, entry.Name())
+
+		entryInfo, err := os.Lstat(entryPath)
+		if err != nil {
+			return err
+		}
+
+		resolvedPath := entryPath
+
+		if entryInfo.Mode()&os.ModeSymlink != 0 {
+			var allowed bool
+
+			switch d.symlinks {
+			case symlinksDeny:
+				continue
+			case symlinksPreserve:
+				target, err := os.Readlink(entryPath)
+				if err != nil || filepath.IsAbs(target) {
+					continue
+				}
+
+				if resolvedPath, allowed = d.resolve(entryPath); !allowed || !isWithinDirectory(archiveDir, resolvedPath) {
+					continue
+				}
+
+				if isIgnored(rules, entryRootRelPath, false) {
+					continue
+				}
+
+				if err := fn(entryPath, entryRelPath, entryInfo); err != nil {
+					return err
+				}
+
+				continue
+			case symlinksFollow:
+				if resolvedPath, allowed = d.resolve(entryPath); !allowed {
+					continue
+				}
+
+				if entryInfo, err = os.Stat(resolvedPath); err != nil {
+					continue
+				}
+			}
+		}
+
+		if isIgnored(rules, entryRootRelPath, entryInfo.IsDir()) {
+			continue
+		}
+
+		if entryInfo.IsDir() {
+			// Guard against loops created by symbolic links pointing back
+			// at a parent directory.
+
+			if visited[resolvedPath] {
+				continue
+			}
+
+			visited[resolvedPath] = true
+
+			err := d.walkDirectory(entryPath, archiveDir, entryRelPath, entryRootRelPath, entryInfo, rules, visited, fn)
+
+			delete(visited, resolvedPath)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := fn(entryPath, entryRelPath, entryInfo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isLocalPath checks that a relative path does not refer to a parent of the
+// directory it is relative to.
+func isLocalPath(relPath string) bool {
+	return relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) && !filepath.IsAbs(relPath)
+}
+
+// isWithinDirectory checks whether a path is the directory or is located under
+// it. Both paths must already have had any symbolic links resolved.
+func isWithinDirectory(dirPath string, targetPath string) bool {
+	relPath, err := filepath.Rel(dirPath, targetPath)
+
+	return err == nil && isLocalPath(relPath)
+}
+
+func createTarArchive(walker *directoryWalker, dirPath string, writer io.Writer) error {
+	tarWriter := tar.NewWriter(writer)
+	defer tarWriter.Close()
+
+	return walker.walk(dirPath, func(path string, relPath string, info os.FileInfo) error {
+		// Read the target of the symbolic link when links are preserved
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			link = target
+		}
+
+		// Create a new tar header
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+
+		// Write the header to the tar archive
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		// If the file is a regular file, write its content to the tar archive
+		if info.Mode().IsRegular() {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(tarWriter, file)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// compressedTarArchive returns a function for creating a tar archive which is
+// compressed using the writer returned by newCompressor.
+func compressedTarArchive(newCompressor func(io.Writer) (io.WriteCloser, error)) func(*directoryWalker, string, io.Writer) error {
+	return func(walker *directoryWalker, dirPath string, writer io.Writer) error {
+		compressor, err := newCompressor(writer)
+		if err != nil {
+			return err
+		}
+
+		if err := createTarArchive(walker, dirPath, compressor); err != nil {
+			compressor.Close()
+			return err
+		}
+
+		return compressor.Close()
+	}
+}
+
+func createZipArchive(walker *directoryWalker, dirPath string, writer io.Writer) error {
+	zipWriter := zip.NewWriter(writer)
+	defer zipWriter.Close()
+
+	return walker.walk(dirPath, func(path string, relPath string, info os.FileInfo) error {
+		// Skip adding directory entries as vendir will fail handling it
+		if info.IsDir() {
+			return nil
+		}
+
+		// Create a new zip header
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = relPath
+
+		// Write the header to the zip archive
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		// If the file is a symbolic link, write the target as its content
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			_, err = writer.Write([]byte(target))
+			return err
+		}
+
+		// If the file is not a directory, write its content to the zip archive
+		if !info.IsDir() {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(writer, file)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// archiveFormat describes a type of archive, or other generated view of a
+// directory, which can be requested by appending one of the suffixes to the
+// directory path.
+type archiveFormat struct {
+	name        string
+	suffixes    []string
+	extension   string
+	contentType string
+	attachment  bool
+	create      func(walker *directoryWalker, dirPath string, writer io.Writer) error
+}
+
+var archiveFormats = []*archiveFormat{
+	{
+		name:        "tar",
+		suffixes:    []string{"/.tar"},
+		extension:   ".tar",
+		contentType: "application/x-tar",
+		attachment:  true,
+		create:      createTarArchive,
+	},
+	{
+		name:        "tar.gz",
+		suffixes:    []string{"/.tar.gz", "/.tgz"},
+		extension:   ".tar.gz",
+		contentType: "application/gzip",
+		attachment:  true,
+		create:      compressedTarArchive(newGzipWriter),
+	},
+	{
+		name:        "tar.zst",
+		suffixes:    []string{"/.tar.zst", "/.tzst"},
+		extension:   ".tar.zst",
+		contentType: "application/zstd",
+		attachment:  true,
+		create:      compressedTarArchive(newZstdWriter),
+	},
+	{
+		name:        "tar.xz",
+		suffixes:    []string{"/.tar.xz", "/.txz"},
+		extension:   ".tar.xz",
+		contentType: "application/x-xz",
+		attachment:  true,
+		create:      compressedTarArchive(newXzWriter),
+	},
+	{
+		name:        "zip",
+		suffixes:    []string{"/.zip"},
+		extension:   ".zip",
+		contentType: "application/zip",
+		attachment:  true,
+		create:      createZipArchive,
+	},
+	{
+		name:        "json",
+		suffixes:    []string{"/.json"},
+		extension:   ".json",
+		contentType: "application/json",
+		create:      createJSONIndex,
+	},
+	{
+		name:        "sha256sums",
+		suffixes:    []string{"/.sha256sums"},
+		extension:   ".sha256sums",
+		contentType: "text/plain; charset=utf-8",
+		create:      createChecksumManifest,
+	},
+}
+
+// lookupArchiveFormat returns the archive format matching the suffix of the
+// request path, along with the path of the directory with the suffix removed.
+func lookupArchiveFormat(requestedPath string) (*archiveFormat, string) {
+	for _, format := range archiveFormats {
+		for _, suffix := range format.suffixes {
+			if strings.HasSuffix(requestedPath, suffix) {
+				return format, strings.TrimSuffix(requestedPath, suffix[1:])
+			}
+		}
+	}
+
+	return nil, requestedPath
+}
+
+// lookupArchiveFormatByName returns the archive format with the given name.
+func lookupArchiveFormatByName(name string) *archiveFormat {
+	for _, format := range archiveFormats {
+		if format.name == name {
+			return format
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// authenticator checks that requests carry either the static bearer token or
+// a valid signature for the request path generated using the signing key.
+// When neither is configured all requests are allowed. Signed URLs only grant
+// read access, so requests which modify files require the bearer token.
+type authenticator struct {
+	token      string
+	signingKey []byte
+}
+
+func (a *authenticator) enabled() bool {
+	return a.token != "" || len(a.signingKey) != 0
+}
+
+// signature calculates the HMAC for a path (or path prefix) and the expiry
+// time of the signed URL.
+func signature(key []byte, path string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d", path, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signURL returns the query string values required to access a path, or when
+// prefix is true any path under it, until the expiry time.
+func signURL(key []byte, path string, prefix bool, expires time.Time) url.Values {
+	values := url.Values{}
+
+	if prefix {
+		if !strings.HasSuffix(path, "/") {
+			path = path + "/"
+		}
+		values.Set("prefix", path)
+	}
+
+	values.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	values.Set("signature", signature(key, path, expires.Unix()))
+
+	return values
+}
+
+// checkSignature validates the signature in the query string of a request,
+// returning an error describing why access was denied if not valid.
+func (a *authenticator) checkSignature(r *http.Request) error {
+	if len(a.signingKey) == 0 {
+		return fmt.Errorf("signed URLs are not enabled")
+	}
+
+	query := r.URL.Query()
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("signed URL has invalid expiry time")
+	}
+
+	signedPath := r.URL.Path
+
+	if prefix := query.Get("prefix"); prefix != "" {
+		if !strings.HasSuffix(prefix, "/") || !strings.HasPrefix(r.URL.Path+"/", prefix) {
+			return fmt.Errorf("signed URL is not valid for this path")
+		}
+		signedPath = prefix
+	}
+
+	expected := signature(a.signingKey, signedPath, expires)
+
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return fmt.Errorf("signed URL has invalid signature")
+	}
+
+	if time.Now().Unix() > expires {
+		return fmt.Errorf("signed URL has expired")
+	}
+
+	return nil
+}
+
+// middleware wraps a handler so that requests without valid credentials are
+// rejected. Requests with no credentials at all get a 401 response, whereas
+// requests with invalid or expired credentials get a 403 response.
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	if !a.enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorization := r.Header.Get("Authorization"); authorization != "" {
+			token := strings.TrimPrefix(authorization, "Bearer ")
+
+			if token == authorization || a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+				log.Printf("Rejected request: %s %s: invalid bearer token", r.Method, r.URL.Path)
+				http.Error(w, "Forbidden: invalid bearer token", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.URL.Query().Has("signature") {
+			if isWriteMethod(r.Method) {
+				log.Printf("Rejected request: %s %s: signed URL used for write", r.Method, r.URL.Path)
+				http.Error(w, "Forbidden: signed URLs only permit read access", http.StatusForbidden)
+				return
+			}
+
+			if err := a.checkSignature(r); err != nil {
+				log.Printf("Rejected request: %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", "Bearer realm=\"assets-server\"")
+		http.Error(w, "Unauthorized: bearer token or signed URL required", http.StatusUnauthorized)
+	})
+}
+
+func newSignCmd() *cobra.Command {
+	var signCmd = &cobra.Command{
+		Use:   "sign PATH",
+		Short: "Generate a signed URL for accessing a path",
+		Args:  cobra.ExactArgs(1),
+		RunE:  signPath,
+	}
+
+	signCmd.Flags().String("signing-key", "", "Secret key used to sign URLs (defaults to $ASSETS_SERVER_SIGNING_KEY)")
+	signCmd.Flags().Duration("expires", time.Hour, "Duration for which the signed URL is valid")
+	signCmd.Flags().Bool("prefix", false, "Allow access to any path under the given path")
+	signCmd.Flags().String("base-url", "", "Base URL of the server to prepend to the signed path")
+
+	return signCmd
+}
+
+func signPath(cmd *cobra.Command, args []string) error {
+	signingKey, _ := cmd.Flags().GetString("signing-key")
+	expires, _ := cmd.Flags().GetDuration("expires")
+	prefix, _ := cmd.Flags().GetBool("prefix")
+	baseURL, _ := cmd.Flags().GetString("base-url")
+
+	if signingKey == "" {
+		signingKey = os.Getenv("ASSETS_SERVER_SIGNING_KEY")
+	}
+
+	if signingKey == "" {
+		return fmt.Errorf("a signing key is required")
+	}
+
+	path := args[0]
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	if prefix && !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+
+	values := signURL([]byte(signingKey), path, prefix, time.Now().Add(expires))
+
+	fmt.Printf("%s%s?%s\n", strings.TrimSuffix(baseURL, "/"), (&url.URL{Path: path}).EscapedPath(), values.Encode())
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	key := []byte("key")
+	expires := time.Now().Add(time.Hour).Unix()
+
+	signed := signature(key, "/a/b", expires)
+
+	tests := []struct {
+		name    string
+		key     []byte
+		path    string
+		expires int64
+	}{
+		{"different key", []byte("other"), "/a/b", expires},
+		{"different path", key, "/a/c", expires},
+		{"different expiry", key, "/a/b", expires + 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if signature(test.key, test.path, test.expires) == signed {
+				t.Error("expected signature to differ")
+			}
+		})
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	key := []byte("key")
+	auth := &authenticator{signingKey: key}
+
+	valid := signURL(key, "/a/b", false, time.Now().Add(time.Hour))
+	prefix := signURL(key, "/a", true, time.Now().Add(time.Hour))
+	expired := signURL(key, "/a/b", false, time.Now().Add(-time.Hour))
+
+	tampered := signURL(key, "/a/b", false, time.Now().Add(time.Hour))
+	tampered.Set("expires", "99999999999")
+
+	tamperedPrefix := signURL(key, "/a", true, time.Now().Add(time.Hour))
+	tamperedPrefix.Set("prefix", "/")
+
+	otherKey := signURL([]byte("other"), "/a/b", false, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		path   string
+		values url.Values
+		valid  bool
+	}{
+		{"valid", "/a/b", valid, true},
+		{"valid for other path", "/a/c", valid, false},
+		{"prefix matches path", "/a/b/c", prefix, true},
+		{"prefix matches directory", "/a", prefix, true},
+		{"prefix does not match sibling", "/ab", prefix, false},
+		{"prefix does not match parent", "/", prefix, false},
+		{"expired", "/a/b", expired, false},
+		{"tampered expiry", "/a/b", tampered, false},
+		{"tampered prefix", "/x", tamperedPrefix, false},
+		{"signed with other key", "/a/b", otherKey, false},
+		{"missing expiry", "/a/b", url.Values{"signature": {valid.Get("signature")}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.path+"?"+test.values.Encode(), nil)
+
+			err := auth.checkSignature(r)
+
+			if test.valid && err != nil {
+				t.Errorf("expected signature to be valid, got %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("expected signature to be rejected")
+			}
+		})
+	}
+}
+
+func TestCheckSignatureNotEnabled(t *testing.T) {
+	auth := &authenticator{token: "token"}
+
+	values := signURL([]byte(""), "/a", false, time.Now().Add(time.Hour))
+
+	if err := auth.checkSignature(httptest.NewRequest(http.MethodGet, "/a?"+values.Encode(), nil)); err == nil {
+		t.Error("expected signature to be rejected when no signing key is set")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	key := []byte("key")
+
+	signed := signURL(key, "/a", false, time.Now().Add(time.Hour)).Encode()
+	expired := signURL(key, "/a", false, time.Now().Add(-time.Hour)).Encode()
+
+	tests := []struct {
+		name          string
+		auth          *authenticator
+		method        string
+		target        string
+		authorization string
+		status        int
+	}{
+		{"no auth configured", &authenticator{}, http.MethodGet, "/a", "", http.StatusOK},
+		{"no credentials", &authenticator{token: "token"}, http.MethodGet, "/a", "", http.StatusUnauthorized},
+		{"valid token", &authenticator{token: "token"}, http.MethodGet, "/a", "Bearer token", http.StatusOK},
+		{"valid token for write", &authenticator{token: "token"}, http.MethodPut, "/a", "Bearer token", http.StatusOK},
+		{"wrong token", &authenticator{token: "token"}, http.MethodGet, "/a", "Bearer wrong", http.StatusForbidden},
+		{"token prefix", &authenticator{token: "token"}, http.MethodGet, "/a", "Bearer tok", http.StatusForbidden},
+		{"token without scheme", &authenticator{token: "token"}, http.MethodGet, "/a", "token", http.StatusForbidden},
+		{"basic auth", &authenticator{token: "token"}, http.MethodGet, "/a", "Basic dG9rZW4=", http.StatusForbidden},
+		{"token when only signing enabled", &authenticator{signingKey: key}, http.MethodGet, "/a", "Bearer ", http.StatusForbidden},
+		{"signed URL", &authenticator{signingKey: key}, http.MethodGet, "/a?" + signed, "", http.StatusOK},
+		{"signed URL for write", &authenticator{signingKey: key}, http.MethodPut, "/a?" + signed, "", http.StatusForbidden},
+		{"expired signed URL", &authenticator{signingKey: key}, http.MethodGet, "/a?" + expired, "", http.StatusForbidden},
+		{"signed URL for other path", &authenticator{signingKey: key}, http.MethodGet, "/b?" + signed, "", http.StatusForbidden},
+		{"signed URL when only token enabled", &authenticator{token: "token"}, http.MethodGet, "/a?" + signed, "", http.StatusForbidden},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.target, nil)
+
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+
+			w := httptest.NewRecorder()
+
+			test.auth.middleware(next).ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, w.Code)
+			}
+
+			if test.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header with 401 response")
+			}
+		})
+	}
+}
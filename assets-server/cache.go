@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// archiveCache holds generated archives on disk, keyed by a digest of the
+// directory tree they were generated from. Concurrent requests for the same
+// archive wait on a single generation, and an archive is only regenerated when
+// the digest of the directory tree changes. Where the total size of the files
+// in the cache exceeds the maximum size, the least recently used are removed.
+type archiveCache struct {
+	dir     string
+	maxSize int64
+	mutex   sync.Mutex
+	pending map[string]*pendingArchive
+	current map[string]string
+	files   map[string]*cachedFile
+	size    int64
+}
+
+// cachedFile records the size of a file in the cache and when it was last
+// used, for deciding which files to remove when the cache is full.
+type cachedFile struct {
+	size     int64
+	lastUsed time.Time
+}
+
+type pendingArchive struct {
+	done chan struct{}
+	err  error
+}
+
+// newArchiveCache creates the cache in the directory, with maxSize being the
+// maximum total size in bytes of the files it holds, or zero for no limit.
+// Files left in the directory by an earlier run are removed, as what they
+// were generated from is not known. Subdirectories, such as that holding
+// pulled images, are left alone.
+func newArchiveCache(dir string, maxSize int64) (*archiveCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &archiveCache{
+		dir:     dir,
+		maxSize: maxSize,
+		pending: map[string]*pendingArchive{},
+		current: map[string]string{},
+		files:   map[string]*cachedFile{},
+	}, nil
+}
+
+// digestDirectory calculates a digest over the names, modes, sizes,
+// modification times and identities of everything under a directory which
+// would be included in an archive, without reading any file content. It also returns the most
+// recent modification time seen, for use in the Last-Modified header.
+func digestDirectory(walker *directoryWalker, dirPath string) (string, time.Time, error) {
+	hash := sha256.New()
+
+	var lastModified time.Time
+
+	err := walker.walk(dirPath, func(path string, relPath string, info os.FileInfo) error {
+		fmt.Fprintf(hash, "%s\x00%o\x00%d\x00%d\x00%s\n", relPath, info.Mode(), info.Size(), info.ModTime().UnixNano(), fileIdentity(info))
+
+		if info.ModTime().After(lastModified) {
+			lastModified = info.ModTime()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), lastModified, nil
+}
+
+// entry returns the cached file with the given name opened for reading,
+// generating it first if it does not exist. The source key identifies what
+// the file was generated from, such that when a new file is generated for the
+// same source key, the file previously generated for it is discarded. The file
+// is opened while holding the lock, so a request which has been given a file
+// can still read it after it has been discarded by another request.
+func (c *archiveCache) entry(name string, sourceKey string, create func(io.Writer) error) (*os.File, error) {
+	cachePath := filepath.Join(c.dir, name)
+
+	for {
+		c.mutex.Lock()
+
+		if pending, ok := c.pending[cachePath]; ok {
+			// Another request is already generating this archive, so wait
+			// for it to complete and use the result.
+
+			c.mutex.Unlock()
+
+			<-pending.done
+
+			if pending.err != nil {
+				return nil, pending.err
+			}
+
+			continue
+		}
+
+		if file, err := os.Open(cachePath); err == nil {
+			if entry, ok := c.files[cachePath]; ok {
+				entry.lastUsed = time.Now()
+			}
+
+			c.mutex.Unlock()
+			return file, nil
+		}
+
+		pending := &pendingArchive{done: make(chan struct{})}
+		c.pending[cachePath] = pending
+
+		c.mutex.Unlock()
+
+		pending.err = c.generate(cachePath, create)
+
+		c.mutex.Lock()
+
+		delete(c.pending, cachePath)
+
+		var file *os.File
+
+		if pending.err == nil {
+			file, pending.err = os.Open(cachePath)
+		}
+
+		// Discard the file previously generated from the same source as it
+		// no longer matches the content of the source.
+
+		if pending.err == nil {
+			if previous, ok := c.current[sourceKey]; ok && previous != cachePath {
+				c.remove(previous)
+			}
+
+			c.current[sourceKey] = cachePath
+
+			c.add(cachePath, file)
+		}
+
+		c.mutex.Unlock()
+
+		close(pending.done)
+
+		return file, pending.err
+	}
+}
+
+// add records a file added to the cache, removing the least recently used
+// files if the cache is now over its maximum size. The file just added is
+// never removed, even if it alone exceeds the maximum size, as it is about
+// to be served. It must be called with the mutex held.
+func (c *archiveCache) add(cachePath string, file *os.File) {
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	if entry, ok := c.files[cachePath]; ok {
+		c.size -= entry.size
+	}
+
+	c.files[cachePath] = &cachedFile{size: info.Size(), lastUsed: time.Now()}
+	c.size += info.Size()
+
+	if c.maxSize <= 0 {
+		return
+	}
+
+	for c.size > c.maxSize {
+		var oldestPath string
+		var oldest *cachedFile
+
+		for path, entry := range c.files {
+			if path != cachePath && (oldest == nil || entry.lastUsed.Before(oldest.lastUsed)) {
+				oldestPath, oldest = path, entry
+			}
+		}
+
+		if oldest == nil {
+			return
+		}
+
+		c.remove(oldestPath)
+	}
+}
+
+// remove deletes a file from the cache. Requests already reading the file can
+// continue to do so. It must be called with the mutex held.
+func (c *archiveCache) remove(cachePath string) {
+	os.Remove(cachePath)
+
+	if entry, ok := c.files[cachePath]; ok {
+		c.size -= entry.size
+		delete(c.files, cachePath)
+	}
+
+	for sourceKey, path := range c.current {
+		if path == cachePath {
+			delete(c.current, sourceKey)
+		}
+	}
+}
+
+func (c *archiveCache) generate(cachePath string, create func(io.Writer) error) error {
+	// Write to a temporary file first and rename it into place so that a
+	// partially written archive is never visible to other requests.
+
+	tmpFile, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	if err := create(tmpFile); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), cachePath)
+}
+
+// serveArchive serves the archive of a directory from the cache. Headers for
+// ETag, Last-Modified and Content-Length are set, and conditional and range
+// requests are handled by http.ServeContent.
+func (c *archiveCache) serveArchive(w http.ResponseWriter, r *http.Request, walker *directoryWalker, dirPath string, format *archiveFormat) {
+	treeDigest, lastModified, err := digestDirectory(walker, dirPath)
+	if err != nil {
+		http.Error(w, "Error creating "+format.name+" archive", http.StatusInternalServerError)
+		return
+	}
+
+	// The digest of the tree is combined with the path of the directory and
+	// the format, so that directories with identical content, such as in
+	// different mounts, don't share a cache file, and the same directory has
+	// distinct keys for each type of archive.
+
+	hash := sha256.Sum256([]byte(dirPath + "\x00" + format.extension + "\x00" + treeDigest))
+	digest := hex.EncodeToString(hash[:])
+
+	file, err := c.entry(digest+format.extension, dirPath+format.extension, func(writer io.Writer) error {
+		log.Printf("Generating %s archive for %s", format.name, dirPath)
+
+		start := time.Now()
+		defer func() {
+			archiveGenerationSeconds.WithLabelValues(format.name).Observe(time.Since(start).Seconds())
+		}()
+
+		return format.create(walker, dirPath, writer)
+	})
+	if err != nil {
+		log.Printf("Error creating %s archive for %s: %v", format.name, dirPath, err)
+		http.Error(w, "Error creating "+format.name+" archive", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", format.contentType)
+	if format.attachment {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"assets%s\"", format.extension))
+	}
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", digest))
+
+	http.ServeContent(w, r, "", lastModified, file)
+}
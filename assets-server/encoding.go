@@ -0,0 +1,246 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func newGzipWriter(writer io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(writer), nil
+}
+
+func newZstdWriter(writer io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(writer)
+}
+
+func newXzWriter(writer io.Writer) (io.WriteCloser, error) {
+	return xz.NewWriter(writer)
+}
+
+func newBrotliWriter(writer io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriter(writer), nil
+}
+
+// contentEncoding describes a compression scheme which can be used as the
+// Content-Encoding when serving static files.
+type contentEncoding struct {
+	name          string
+	newCompressor func(io.Writer) (io.WriteCloser, error)
+}
+
+// contentEncodings lists the supported encodings in order of preference for
+// when the client accepts more than one with the same quality value.
+var contentEncodings = []*contentEncoding{
+	{name: "zstd", newCompressor: newZstdWriter},
+	{name: "br", newCompressor: newBrotliWriter},
+	{name: "gzip", newCompressor: newGzipWriter},
+}
+
+// minimumEncodingSize is the size below which a file is not worth compressing.
+const minimumEncodingSize = 1024
+
+// maximumEncodingSize is the size above which a file is served as is rather
+// than compressed, so that a request for a large file is not held up while a
+// compressed copy is generated, and the cache is not filled with copies of
+// large files. Files this large are usually already compressed anyway.
+const maximumEncodingSize = 64 << 20
+
+// precompressedExtensions lists extensions of file types which are already
+// compressed, and so gain nothing from being compressed again.
+var precompressedExtensions = map[string]bool{
+	".7z": true, ".avif": true, ".br": true, ".bz2": true, ".deb": true,
+	".gif": true, ".gz": true, ".jar": true, ".jpeg": true, ".jpg": true,
+	".mp3": true, ".mp4": true, ".png": true, ".rpm": true, ".tgz": true,
+	".txz": true, ".webm": true, ".webp": true, ".whl": true, ".woff": true,
+	".woff2": true, ".xz": true, ".zip": true, ".zst": true,
+}
+
+// compressedContentTypes lists media types, in addition to those for images,
+// audio and video, of content which is already compressed.
+var compressedContentTypes = map[string]bool{
+	"application/gzip": true, "application/pdf": true,
+	"application/vnd.rar": true, "application/x-7z-compressed": true,
+	"application/x-bzip2": true, "application/x-gzip": true,
+	"application/x-rar-compressed": true, "application/x-xz": true,
+	"application/zip": true, "application/zstd": true,
+	"font/woff": true, "font/woff2": true,
+}
+
+// isCompressedContentType returns whether content of the type is already
+// compressed, and so gains nothing from being compressed again. Of images,
+// only SVG and BMP images are not compressed.
+func isCompressedContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "image/svg+xml", mediaType == "image/bmp":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return true
+	}
+
+	return compressedContentTypes[mediaType]
+}
+
+// negotiateEncoding selects the content encoding to use based on the
+// Accept-Encoding header of the request, returning nil if the file should be
+// sent without any encoding.
+func negotiateEncoding(acceptEncoding string) *contentEncoding {
+	var selected *contentEncoding
+	var selectedQuality float64
+
+	for _, encoding := range contentEncodings {
+		quality := 0.0
+
+		for _, item := range strings.Split(acceptEncoding, ",") {
+			parts := strings.Split(item, ";")
+			coding := strings.ToLower(strings.TrimSpace(parts[0]))
+
+			if coding != encoding.name && coding != "*" {
+				continue
+			}
+
+			itemQuality := 1.0
+
+			for _, param := range parts[1:] {
+				if value, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+					if q, err := strconv.ParseFloat(value, 64); err == nil {
+						itemQuality = q
+					}
+				}
+			}
+
+			// An explicit entry for the encoding takes precedence over
+			// the wildcard entry.
+
+			if coding == encoding.name {
+				quality = itemQuality
+				break
+			}
+
+			quality = itemQuality
+		}
+
+		if quality > selectedQuality {
+			selected = encoding
+			selectedQuality = quality
+		}
+	}
+
+	return selected
+}
+
+// serveEncodedFile serves a static file compressed using an encoding accepted
+// by the client, returning false without writing a response if the file is
+// not a candidate for compression. Files which are too small or too large,
+// or whose content is already compressed, are not candidates. Compressed files
+// are held in the cache, keyed by the path, size, modification time and
+// identity of the original file.
+func (c *archiveCache) serveEncodedFile(w http.ResponseWriter, r *http.Request, filePath string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/") || strings.HasSuffix(r.URL.Path, "/index.html") {
+		return false
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	if info.Size() < minimumEncodingSize || info.Size() > maximumEncodingSize {
+		return false
+	}
+
+	if precompressedExtensions[strings.ToLower(filepath.Ext(filePath))] {
+		return false
+	}
+
+	// Determine the content type from the original file as http.ServeContent
+	// would otherwise attempt to sniff it from the compressed data.
+
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+
+	if contentType == "" {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return false
+		}
+
+		buffer := make([]byte, 512)
+		n, _ := io.ReadFull(file, buffer)
+		file.Close()
+
+		contentType = http.DetectContentType(buffer[:n])
+	}
+
+	if isCompressedContentType(contentType) {
+		return false
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+
+	if encoding == nil {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%s", encoding.name, filePath, info.Size(), info.ModTime().UnixNano(), fileIdentity(info))))
+	digest := hex.EncodeToString(hash[:])
+
+	cachedFile, err := c.entry(digest+"."+encoding.name, filePath+"\x00"+encoding.name, func(writer io.Writer) error {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		compressor, err := encoding.newCompressor(writer)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(compressor, file); err != nil {
+			compressor.Close()
+			return err
+		}
+
+		return compressor.Close()
+	})
+
+	if err != nil {
+		log.Printf("Error compressing %s using %s: %v", filePath, encoding.name, err)
+		return false
+	}
+	defer cachedFile.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", encoding.name)
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", digest))
+
+	http.ServeContent(w, r, "", info.ModTime(), cachedFile)
+
+	return true
+}
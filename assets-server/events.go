@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// eventsSuffix is appended to the path of a directory to request a stream of
+// change notifications for files under the directory.
+const eventsSuffix = "/.events"
+
+const (
+	eventCreated  = "created"
+	eventModified = "modified"
+	eventDeleted  = "deleted"
+)
+
+// eventCoalesceInterval is how long changes are collected before being sent,
+// so that the many low level events generated when a file is written result
+// in a single notification.
+const eventCoalesceInterval = 200 * time.Millisecond
+
+// eventHistorySize is the number of recent notifications kept so that clients
+// which reconnect can be sent those they missed.
+const eventHistorySize = 1000
+
+// eventKeepaliveInterval is how often a comment is sent on an idle stream to
+// stop proxies from closing the connection.
+const eventKeepaliveInterval = 30 * time.Second
+
+// changeEvent describes a change to a file, directory or symbolic link, with
+// the path relative to the root directory.
+type changeEvent struct {
+	id     uint64
+	Action string `json:"-"`
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+}
+
+type pendingChange struct {
+	action string
+	kind   string
+	order  int
+}
+
+// changeNotifier watches a root directory and all directories under it for
+// changes, and distributes notifications of changes to subscribers.
+type changeNotifier struct {
+	walker   *directoryWalker
+	watcher  *fsnotify.Watcher
+	instance string
+
+	mutex       sync.Mutex
+	watched     map[string]bool
+	pending     map[string]*pendingChange
+	order       int
+	nextID      uint64
+	history     []changeEvent
+	subscribers map[chan changeEvent]bool
+	closed      bool
+}
+
+func newChangeNotifier(walker *directoryWalker) (*changeNotifier, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	notifier := &changeNotifier{
+		walker:      walker,
+		watcher:     watcher,
+		instance:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		watched:     map[string]bool{},
+		pending:     map[string]*pendingChange{},
+		nextID:      1,
+		subscribers: map[chan changeEvent]bool{},
+	}
+
+	if err := notifier.addWatches(".", false); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go notifier.run()
+
+	return notifier, nil
+}
+
+// addWatches adds watches for a directory and all directories under it. When
+// the directory has just been created, notifications are also generated for
+// everything found in it, as these may have been created before the watches
+// were in place. Must be called with the mutex held, except when called from
+// the constructor.
+func (n *changeNotifier) addWatches(relDir string, created bool) error {
+	return filepath.WalkDir(filepath.Join(n.walker.rootDir, filepath.FromSlash(relDir)), func(entryPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The directory may have been removed again already.
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(n.walker.rootDir, entryPath)
+		relPath = filepath.ToSlash(relPath)
+
+		if strings.HasPrefix(entry.Name(), uploadStagingPrefix) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if created {
+			n.record(relPath, eventCreated, entryKind(entry.Type()))
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if err := n.watcher.Add(entryPath); err != nil {
+			return fmt.Errorf("unable to watch %s: %v", entryPath, err)
+		}
+
+		n.watched[relPath] = true
+
+		return nil
+	})
+}
+
+func entryKind(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// record adds a change to those waiting to be sent, combining it with any
+// change to the same path already waiting. Must be called with the mutex held.
+func (n *changeNotifier) record(relPath string, action string, kind string) {
+	change, found := n.pending[relPath]
+
+	if !found {
+		n.pending[relPath] = &pendingChange{action: action, kind: kind, order: n.order}
+		n.order++
+		return
+	}
+
+	change.kind = kind
+
+	switch {
+	case change.action == eventCreated && action == eventDeleted:
+		// Nothing to report for a file which came and went, such as the
+		// temporary file of an editor.
+		delete(n.pending, relPath)
+	case change.action == eventCreated:
+		// A file which was created and then written is reported as created.
+	case change.action == eventDeleted && action == eventCreated:
+		change.action = eventModified
+	default:
+		change.action = action
+	}
+}
+
+// run processes events from the watcher until it is closed.
+func (n *changeNotifier) run() {
+	ticker := time.NewTicker(eventCoalesceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return
+			}
+			n.handle(event)
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error watching %s: %v", n.walker.rootDir, err)
+		case <-ticker.C:
+			n.flush()
+		}
+	}
+}
+
+func (n *changeNotifier) handle(event fsnotify.Event) {
+	relPath, err := filepath.Rel(n.walker.rootDir, event.Name)
+	if err != nil || relPath == "." {
+		return
+	}
+
+	relPath = filepath.ToSlash(relPath)
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Lstat(event.Name)
+		if err != nil {
+			// Already removed again, so record it as created in order for
+			// the removal to cancel it out.
+			n.record(relPath, eventCreated, "file")
+			return
+		}
+
+		if info.IsDir() {
+			if err := n.addWatches(relPath, true); err != nil {
+				log.Printf("Error watching %s: %v", event.Name, err)
+			}
+			return
+		}
+
+		n.record(relPath, eventCreated, entryKind(info.Mode()))
+	case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+		kind := "file"
+
+		if n.watched[relPath] {
+			kind = "directory"
+
+			for watchedPath := range n.watched {
+				if watchedPath == relPath || strings.HasPrefix(watchedPath, relPath+"/") {
+					n.watcher.Remove(filepath.Join(n.walker.rootDir, filepath.FromSlash(watchedPath)))
+					delete(n.watched, watchedPath)
+				}
+			}
+		}
+
+		n.record(relPath, eventDeleted, kind)
+	case event.Has(fsnotify.Write) || event.Has(fsnotify.Chmod):
+		info, err := os.Lstat(event.Name)
+		if err != nil {
+			return
+		}
+
+		n.record(relPath, eventModified, entryKind(info.Mode()))
+	}
+}
+
+// flush sends the changes collected since the last flush to subscribers, in
+// the order the paths were first changed.
+func (n *changeNotifier) flush() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if len(n.pending) == 0 {
+		return
+	}
+
+	relPaths := make([]string, 0, len(n.pending))
+
+	for relPath := range n.pending {
+		relPaths = append(relPaths, relPath)
+	}
+
+	sort.Slice(relPaths, func(i, j int) bool {
+		return n.pending[relPaths[i]].order < n.pending[relPaths[j]].order
+	})
+
+	for _, relPath := range relPaths {
+		change := n.pending[relPath]
+		event := changeEvent{Action: change.action, Path: relPath, Type: change.kind}
+
+		if n.walker.isExcluded(event.Path, event.Type == "directory") {
+			continue
+		}
+
+		event.id = n.nextID
+		n.nextID++
+
+		n.history = append(n.history, event)
+
+		for subscriber := range n.subscribers {
+			select {
+			case subscriber <- event:
+			default:
+				// Disconnect a subscriber which is not keeping up. The
+				// client can reconnect and catch up from the history.
+				delete(n.subscribers, subscriber)
+				close(subscriber)
+			}
+		}
+	}
+
+	n.pending = map[string]*pendingChange{}
+	n.order = 0
+
+	if len(n.history) > eventHistorySize {
+		n.history = append([]changeEvent(nil), n.history[len(n.history)-eventHistorySize:]...)
+	}
+}
+
+// subscribe registers for notifications of changes. When the identifier of
+// the last event received by a client is provided, the events since then are
+// returned so they can be sent first. If those events are no longer held, or
+// the identifier is from a previous instance of the server, complete is false
+// and the client must assume anything may have changed.
+func (n *changeNotifier) subscribe(lastEventID string) (chan changeEvent, []changeEvent, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.closed {
+		return nil, nil, false
+	}
+
+	subscriber := make(chan changeEvent, 256)
+	n.subscribers[subscriber] = true
+
+	if lastEventID == "" {
+		return subscriber, nil, true
+	}
+
+	instance, sequence, _ := strings.Cut(lastEventID, "-")
+	lastID, err := strconv.ParseUint(sequence, 10, 64)
+
+	if instance != n.instance || err != nil || lastID >= n.nextID {
+		return subscriber, nil, false
+	}
+
+	if len(n.history) != 0 && n.history[0].id > lastID+1 {
+		return subscriber, nil, false
+	}
+
+	var missed []changeEvent
+
+	for _, event := range n.history {
+		if event.id > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	return subscriber, missed, true
+}
+
+func (n *changeNotifier) unsubscribe(subscriber chan changeEvent) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.subscribers[subscriber] {
+		delete(n.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// close stops watching for changes and ends all event streams, so that they
+// do not hold up shutdown of the server.
+func (n *changeNotifier) close() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.closed {
+		return
+	}
+
+	n.closed = true
+	n.watcher.Close()
+
+	for subscriber := range n.subscribers {
+		delete(n.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// serveEvents streams notifications of changes under a directory as server
+// sent events. Each event is named after the action, being "created",
+// "modified" or "deleted", and the data gives the path relative to the
+// directory and the type of the entry. A "reset" event is sent when a client
+// reconnects but the events it missed are no longer available, in which case
+// it should fetch the whole directory again.
+func (n *changeNotifier) serveEvents(w http.ResponseWriter, r *http.Request, requestedPath string) {
+	relDir := strings.TrimPrefix(path.Clean("/"+strings.TrimSuffix(requestedPath, eventsSuffix)), "/")
+
+	if relDir == "" {
+		relDir = "."
+	}
+
+	info, err := os.Stat(filepath.Join(n.walker.rootDir, filepath.FromSlash(relDir)))
+	if err != nil || !info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	subscriber, missed, complete := n.subscribe(r.Header.Get("Last-Event-ID"))
+	if subscriber == nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer n.unsubscribe(subscriber)
+
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent := func(event changeEvent) error {
+		eventPath := event.Path
+
+		if relDir != "." {
+			if eventPath == relDir {
+				eventPath = "."
+			} else if !strings.HasPrefix(eventPath, relDir+"/") {
+				return nil
+			} else {
+				eventPath = strings.TrimPrefix(eventPath, relDir+"/")
+			}
+		}
+
+		data, err := json.Marshal(changeEvent{Path: eventPath, Type: event.Type})
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "id: %s-%d\nevent: %s\ndata: %s\n\n", n.instance, event.id, event.Action, data)
+
+		return err
+	}
+
+	if !complete {
+		fmt.Fprintf(w, "event: reset\ndata: {}\n\n")
+	}
+
+	for _, event := range missed {
+		if err := writeEvent(event); err != nil {
+			return
+		}
+	}
+
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(eventKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-subscriber:
+			if !ok {
+				return
+			}
+			if err := writeEvent(event); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprintf(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxArchiveEntries limits the number of entries unpacked from an uploaded
+// archive.
+const maxArchiveEntries = 100000
+
+// errArchiveTooLarge is returned when unpacking an archive would exceed the
+// limits on the size of what is unpacked.
+var errArchiveTooLarge = errors.New("unpacked archive is too large")
+
+// extractLimit keeps a running count of the bytes and entries unpacked from an
+// archive, so that a small compressed archive cannot expand to fill the disk.
+// A nil limit places no restriction on what is unpacked.
+type extractLimit struct {
+	maxSize    int64
+	maxEntries int
+
+	size    int64
+	entries int
+}
+
+func newExtractLimit(maxSize int64) *extractLimit {
+	return &extractLimit{maxSize: maxSize, maxEntries: maxArchiveEntries}
+}
+
+// entry counts an entry of the archive, failing if there are too many.
+func (l *extractLimit) entry() error {
+	if l == nil {
+		return nil
+	}
+
+	l.entries++
+
+	if l.entries > l.maxEntries {
+		return fmt.Errorf("%w: more than %d entries", errArchiveTooLarge, l.maxEntries)
+	}
+
+	return nil
+}
+
+// reader wraps a reader so that the bytes read from it are counted against
+// the limit, failing the read once the limit is exceeded.
+func (l *extractLimit) reader(reader io.Reader) io.Reader {
+	if l == nil {
+		return reader
+	}
+
+	return &limitedReader{reader: reader, limit: l}
+}
+
+type limitedReader struct {
+	reader io.Reader
+	limit  *extractLimit
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+
+	r.limit.size += int64(n)
+
+	if r.limit.size > r.limit.maxSize {
+		return n, fmt.Errorf("%w: more than %d bytes", errArchiveTooLarge, r.limit.maxSize)
+	}
+
+	return n, err
+}
+
+// extractTarArchive unpacks a tar archive into a directory. Entries which
+// would be written outside of the directory, either directly or by way of a
+// symbolic link unpacked earlier from the same archive, are rejected, as are
+// symbolic links which are absolute or point outside of the directory. The
+// decompressed stream, which includes the content of each file, is counted
+// against the limit, which may be nil.
+func extractTarArchive(reader io.Reader, dirPath string, limit *extractLimit) error {
+	rootPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(limit.reader(reader))
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := limit.entry(); err != nil {
+			return err
+		}
+
+		target, err := extractTarget(rootPath, header.Name)
+		if err != nil {
+			return err
+		}
+
+		if target == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			os.Chtimes(target, header.ModTime, header.ModTime)
+		case tar.TypeReg:
+			if err := extractFile(target, os.FileMode(header.Mode), tarReader, header.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := extractSymlink(rootPath, target, header.Linkname); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractZipArchive unpacks a zip archive into a directory, with the same
+// restrictions as for tar archives. As each file is decompressed separately,
+// the decompressed content of each file is counted against the limit.
+func extractZipArchive(reader io.ReaderAt, size int64, dirPath string, limit *extractLimit) error {
+	rootPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return err
+	}
+
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zipReader.File {
+		if err := limit.entry(); err != nil {
+			return err
+		}
+
+		target, err := extractTarget(rootPath, file.Name)
+		if err != nil {
+			return err
+		}
+
+		if target == "" {
+			continue
+		}
+
+		mode := file.Mode()
+
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			content, err := file.Open()
+			if err != nil {
+				return err
+			}
+
+			linkname, err := io.ReadAll(limit.reader(content))
+			content.Close()
+
+			if err != nil {
+				return err
+			}
+
+			if err := extractSymlink(rootPath, target, string(linkname)); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			content, err := file.Open()
+			if err != nil {
+				return err
+			}
+
+			err = extractFile(target, mode, limit.reader(content), file.Modified)
+			content.Close()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// extractTarget validates the name of an archive entry and returns the path
+// to extract it to, after creating any missing parent directories. An empty
+// path is returned for an entry referring to the root directory itself.
+func extractTarget(rootPath string, name string) (string, error) {
+	relPath := strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+
+	if relPath == "." || relPath == "" {
+		return "", nil
+	}
+
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", fmt.Errorf("invalid path %q in archive", name)
+	}
+
+	if err := makeParentDirectories(rootPath, relPath); err != nil {
+		return "", fmt.Errorf("invalid path %q in archive: %v", name, err)
+	}
+
+	return filepath.Join(rootPath, filepath.FromSlash(relPath)), nil
+}
+
+func extractFile(target string, mode os.FileMode, reader io.Reader, modTime time.Time) error {
+	os.Remove(target)
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0o200)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if !modTime.IsZero() {
+		os.Chtimes(target, modTime, modTime)
+	}
+
+	return nil
+}
+
+// extractSymlink creates a symbolic link, provided the link is relative and
+// points at something within the root directory. As no parent directory of
+// the link can be a symbolic link, where the link points can be determined
+// from the path alone, and any link it points at in turn has itself been
+// checked in the same way.
+func extractSymlink(rootPath string, target string, linkname string) error {
+	if linkname == "" || filepath.IsAbs(linkname) || path.IsAbs(filepath.ToSlash(linkname)) {
+		return fmt.Errorf("invalid symbolic link %q to %q in archive, must be relative", filepath.Base(target), linkname)
+	}
+
+	if !isWithinDirectory(rootPath, filepath.Join(filepath.Dir(target), linkname)) {
+		return fmt.Errorf("invalid symbolic link %q to %q in archive, points outside of directory", filepath.Base(target), linkname)
+	}
+
+	os.Remove(target)
+
+	return os.Symlink(linkname, target)
+}
+
+// makeParentDirectories creates any missing parent directories for a slash
+// separated path relative to the root directory. An error is returned if any
+// existing parent is a symbolic link or not a directory, so that nothing can
+// be written outside of the root directory.
+func makeParentDirectories(rootPath string, relPath string) error {
+	parentPath := rootPath
+
+	for _, component := range strings.Split(path.Dir(relPath), "/") {
+		if component == "." {
+			break
+		}
+
+		parentPath = filepath.Join(parentPath, component)
+
+		info, err := os.Lstat(parentPath)
+
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(parentPath, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent directory %q is a symbolic link", component)
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("parent directory %q is not a directory", component)
+		}
+	}
+
+	return nil
+}
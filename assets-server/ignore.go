@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the name of the file in a directory holding rules, using
+// the same syntax as .gitignore, for files to exclude when generating archives
+// of the directory or any directory above it.
+const ignoreFileName = ".assetsignore"
+
+type ignorePattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreRules holds the patterns from a single ignore file, which are matched
+// against paths relative to the directory the ignore file is in.
+type ignoreRules struct {
+	relDir   string
+	patterns []*ignorePattern
+}
+
+// loadIgnoreRules reads the ignore file from a directory, returning nil if
+// the directory does not have one.
+func loadIgnoreRules(dirPath string, relDir string) (*ignoreRules, error) {
+	file, err := os.Open(filepath.Join(dirPath, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := &ignoreRules{relDir: relDir}
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if pattern := parseIgnorePattern(scanner.Text()); pattern != nil {
+			rules.patterns = append(rules.patterns, pattern)
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+func parseIgnorePattern(line string) *ignorePattern {
+	line = strings.TrimRight(line, "\r")
+
+	// Trailing spaces are ignored unless escaped with a backslash.
+
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	pattern := &ignorePattern{}
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A pattern containing a slash other than at the end is matched against
+	// the full relative path, otherwise it is matched against the name of
+	// the file or directory at any depth.
+
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return nil
+	}
+
+	pattern.segments = strings.Split(line, "/")
+
+	return pattern
+}
+
+func (p *ignorePattern) matches(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if !p.anchored {
+		matched, _ := path.Match(p.segments[0], path.Base(relPath))
+		return matched
+	}
+
+	return matchSegments(p.segments, strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where a "**"
+// pattern segment matches zero or more path segments.
+func matchSegments(patterns []string, segments []string) bool {
+	for len(patterns) != 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(patterns[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if matched, _ := path.Match(patterns[0], segments[0]); !matched {
+			return false
+		}
+
+		patterns = patterns[1:]
+		segments = segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// isIgnored checks whether a path relative to the directory being archived
+// is excluded by the ignore rules found in it or its parent directories. The
+// last matching pattern wins, with rules from a deeper directory taking
+// precedence over those of its parents.
+func isIgnored(rules []*ignoreRules, relPath string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		rulesRelPath := relPath
+
+		if rules[i].relDir != "." {
+			rulesRelPath = strings.TrimPrefix(relPath, rules[i].relDir+"/")
+		}
+
+		patterns := rules[i].patterns
+
+		for j := len(patterns) - 1; j >= 0; j-- {
+			if patterns[j].matches(rulesRelPath, isDir) {
+				return !patterns[j].negate
+			}
+		}
+	}
+
+	return false
+}
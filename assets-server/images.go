@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// imagePullTimeout limits how long checking the registry for a new version of
+// an image and pulling and unpacking it can take.
+const imagePullTimeout = 10 * time.Minute
+
+// imageSource maps a URL path prefix to the files contained in an OCI image
+// artifact, such as those created by "educates workshop publish". The image
+// is pulled and unpacked into a local cache directory, and the registry is
+// checked for a new version of the image once the refresh interval expires.
+type imageSource struct {
+	prefix    string
+	reference string
+	symlinks  string
+	cacheDir  string
+	ttl       time.Duration
+	insecure  bool
+	handler   http.Handler
+
+	// pullMutex is held while checking the registry and pulling the image,
+	// so only one pull of the image happens at a time. The mutex for the
+	// state of the image source is only held briefly, so requests are not
+	// blocked while a pull is in progress.
+
+	pullMutex sync.Mutex
+
+	mutex      sync.Mutex
+	refreshing bool
+	current    string
+	previous   string
+	digest     string
+	checked    time.Time
+}
+
+// parseImageFlag parses an image given on the command line in the format
+// "prefix=reference".
+func parseImageFlag(value string) (imageConfig, error) {
+	prefix, reference, found := strings.Cut(value, "=")
+
+	if !found || reference == "" {
+		return imageConfig{}, fmt.Errorf("invalid image mapping %q, expected prefix=reference", value)
+	}
+
+	return imageConfig{Prefix: prefix, Image: reference}, nil
+}
+
+// imageOptions holds the server wide options which apply to every image.
+type imageOptions struct {
+	cache    *archiveCache
+	cacheDir string
+	ttl      time.Duration
+	insecure bool
+}
+
+func newImageSource(config imageConfig, options imageOptions) (*imageSource, error) {
+	prefix := "/" + strings.Trim(config.Prefix, "/")
+
+	if prefix == "/" {
+		return nil, fmt.Errorf("image %s cannot be served at the root path", config.Image)
+	}
+
+	if config.Image == "" {
+		return nil, fmt.Errorf("image mapping %s has no image reference", prefix)
+	}
+
+	// Check the policy for symbolic links up front, as the walker for the
+	// files of the image can only be created once it has been pulled.
+	if _, err := newDirectoryWalker(options.cacheDir, config.Symlinks); err != nil {
+		return nil, fmt.Errorf("image %s: %v", prefix, err)
+	}
+
+	s := &imageSource{
+		prefix:    prefix,
+		reference: config.Image,
+		symlinks:  config.Symlinks,
+		cacheDir:  filepath.Join(options.cacheDir, strings.ReplaceAll(strings.Trim(prefix, "/"), "/", "_")),
+		ttl:       options.ttl,
+		insecure:  options.insecure,
+	}
+
+	auth := &authenticator{token: config.Token, signingKey: []byte(config.SigningKey)}
+
+	s.handler = auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.serveHTTP(w, r, options.cache)
+	}))
+
+	return s, nil
+}
+
+// relativePath returns the part of a request path under the image prefix.
+func (s *imageSource) relativePath(requestPath string) string {
+	if requestPath == s.prefix {
+		return "/"
+	}
+
+	return strings.TrimPrefix(requestPath, s.prefix)
+}
+
+func (s *imageSource) serveHTTP(w http.ResponseWriter, r *http.Request, cache *archiveCache) {
+	requestedPath := s.relativePath(r.URL.Path)
+
+	if isWriteMethod(r.Method) {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rootDir, err := s.root()
+	if err != nil {
+		log.Printf("Error pulling image %s: %v", s.reference, err)
+		http.Error(w, "Error pulling image", http.StatusBadGateway)
+		return
+	}
+
+	walker, err := newDirectoryWalker(rootDir, s.symlinks)
+	if err != nil {
+		log.Printf("Error serving image %s: %v", s.reference, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	serveDirectory(w, r, cache, walker, nil, requestedPath)
+}
+
+// lookupImageSource returns the image source whose prefix matches the request
+// path, along with the remainder of the request path under the prefix.
+func lookupImageSource(sources []*imageSource, requestedPath string) (*imageSource, string) {
+	for _, source := range sources {
+		if requestedPath == source.prefix {
+			return source, "/"
+		}
+
+		if strings.HasPrefix(requestedPath, source.prefix+"/") {
+			return source, strings.TrimPrefix(requestedPath, source.prefix)
+		}
+	}
+
+	return nil, requestedPath
+}
+
+// root returns the directory holding the unpacked files of the image. The
+// first request blocks until the image has been pulled. After that, once the
+// refresh interval has expired, the registry is checked in the background
+// while the existing copy of the files continues to be served.
+func (s *imageSource) root() (string, error) {
+	s.mutex.Lock()
+
+	current := s.current
+
+	if current != "" && time.Since(s.checked) > s.ttl && !s.refreshing {
+		s.refreshing = true
+
+		go func() {
+			s.pullMutex.Lock()
+			defer s.pullMutex.Unlock()
+
+			if err := s.refresh(); err != nil {
+				log.Printf("Error refreshing image %s: %v", s.reference, err)
+			}
+
+			s.mutex.Lock()
+			s.refreshing = false
+			s.mutex.Unlock()
+		}()
+	}
+
+	s.mutex.Unlock()
+
+	if current != "" {
+		return current, nil
+	}
+
+	// Nothing has been pulled yet, so wait for the image to be pulled, unless
+	// another request already did so while waiting.
+
+	s.pullMutex.Lock()
+	defer s.pullMutex.Unlock()
+
+	s.mutex.Lock()
+	current = s.current
+	s.mutex.Unlock()
+
+	if current != "" {
+		return current, nil
+	}
+
+	if err := s.refresh(); err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.current, nil
+}
+
+// refresh pulls the image if its digest in the registry differs from that of
+// the copy already unpacked, then switches to serving the new copy. Must be
+// called with the pull mutex held, but not the mutex for the state.
+func (s *imageSource) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), imagePullTimeout)
+	defer cancel()
+
+	var options []name.Option
+
+	if s.insecure {
+		options = append(options, name.Insecure)
+	}
+
+	ref, err := name.ParseReference(s.reference, options...)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.checked = time.Now()
+	knownDigest := s.digest
+	s.mutex.Unlock()
+
+	remoteOptions := []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+	}
+
+	descriptor, err := remote.Head(ref, remoteOptions...)
+	if err != nil {
+		return err
+	}
+
+	digest := descriptor.Digest.Hex
+
+	if digest == knownDigest {
+		return nil
+	}
+
+	log.Printf("Pulling image %s (%s)", s.reference, descriptor.Digest)
+
+	image, err := remote.Image(ref, remoteOptions...)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.cacheDir, 0o755); err != nil {
+		return err
+	}
+
+	targetDir := filepath.Join(s.cacheDir, digest)
+
+	if _, err := os.Stat(targetDir); err != nil {
+		stagingDir, err := os.MkdirTemp(s.cacheDir, ".tmp-*")
+		if err != nil {
+			return err
+		}
+
+		reader := mutate.Extract(image)
+		defer reader.Close()
+
+		if err := extractTarArchive(reader, stagingDir, nil); err != nil {
+			os.RemoveAll(stagingDir)
+			return err
+		}
+
+		if err := os.Rename(stagingDir, targetDir); err != nil {
+			os.RemoveAll(stagingDir)
+			return err
+		}
+	}
+
+	// Keep the files for the previous version of the image around, as there
+	// may be requests still reading from it, but discard any older version.
+
+	s.mutex.Lock()
+
+	discard := ""
+
+	if s.current != targetDir {
+		if s.previous != targetDir {
+			discard = s.previous
+		}
+
+		s.previous = s.current
+	}
+
+	s.current = targetDir
+	s.digest = digest
+
+	s.mutex.Unlock()
+
+	if discard != "" {
+		os.RemoveAll(discard)
+	}
+
+	return nil
+}
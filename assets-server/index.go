@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// indexEntry describes a single file, directory or symbolic link in the JSON
+// index of a directory.
+type indexEntry struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Target  string    `json:"target,omitempty"`
+}
+
+type indexResponse struct {
+	Files []indexEntry `json:"files"`
+}
+
+func checksumFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func createJSONIndex(walker *directoryWalker, dirPath string, writer io.Writer) error {
+	index := indexResponse{Files: []indexEntry{}}
+
+	err := walker.walk(dirPath, func(path string, relPath string, info os.FileInfo) error {
+		// Skip the entry for the directory itself
+		if relPath == "." {
+			return nil
+		}
+
+		entry := indexEntry{
+			Path:    relPath,
+			Size:    info.Size(),
+			Mode:    fmt.Sprintf("%04o", info.Mode().Perm()),
+			ModTime: info.ModTime().UTC(),
+		}
+
+		switch {
+		case info.IsDir():
+			entry.Type = "directory"
+			entry.Size = 0
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry.Type = "symlink"
+			entry.Target = target
+		case info.Mode().IsRegular():
+			checksum, err := checksumFile(path)
+			if err != nil {
+				return err
+			}
+			entry.Type = "file"
+			entry.SHA256 = checksum
+		default:
+			return nil
+		}
+
+		index.Files = append(index.Files, entry)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(index)
+}
+
+// createChecksumManifest writes a manifest of regular files in the format
+// output by sha256sum, so it can be verified using "sha256sum -c" from within
+// the directory the files were unpacked into. As with sha256sum, a name
+// containing a backslash, newline or carriage return is escaped and the line
+// marked with a leading backslash.
+func createChecksumManifest(walker *directoryWalker, dirPath string, writer io.Writer) error {
+	return walker.walk(dirPath, func(path string, relPath string, info os.FileInfo) error {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		checksum, err := checksumFile(path)
+		if err != nil {
+			return err
+		}
+
+		prefix, name := escapeChecksumName(relPath)
+
+		_, err = fmt.Fprintf(writer, "%s%s  %s\n", prefix, checksum, name)
+
+		return err
+	})
+}
+
+// checksumNameEscaper escapes a name in the same way as sha256sum.
+var checksumNameEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+
+// escapeChecksumName returns the name escaped for a checksum manifest, and
+// the prefix marking the line as escaped if it needed to be.
+func escapeChecksumName(name string) (string, string) {
+	if !strings.ContainsAny(name, "\\\n\r") {
+		return "", name
+	}
+
+	return "\\", checksumNameEscaper.Replace(name)
+}
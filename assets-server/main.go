@@ -8,129 +8,169 @@
  * served, the port the server listens on, and the host interface the listener
  * socket is bound to.
  *
+ * Static files are compressed using gzip, zstd or brotli when accepted by the
+ * client, as indicated by the Accept-Encoding request header.
+ *
+ * Generated archives are cached on disk, keyed by a digest of the directory
+ * tree, and served with ETag and Last-Modified headers so clients can use
+ * conditional requests to revalidate them. The least recently used archives
+ * are removed when the cache grows beyond --cache-max-size.
+ *
  * The server can handle the following types of requests:
  *   - Requests for regular static files (e.g., http://localhost:8080/file.txt)
  *   - Requests for tar archives of directories (e.g., http://localhost:8080/subdir/.tar)
  *   - Requests for tar.gz or .tgz archives of directories (e.g., http://localhost:8080/subdir/.tar.gz)
+ *   - Requests for tar.zst or .tzst archives of directories (e.g., http://localhost:8080/subdir/.tar.zst)
+ *   - Requests for tar.xz or .txz archives of directories (e.g., http://localhost:8080/subdir/.tar.xz)
  *   - Requests for zip archives of directories (e.g., http://localhost:8080/subdir/.zip)
+ *   - Requests for a JSON index of directories (e.g., http://localhost:8080/subdir/.json)
+ *   - Requests for a SHA-256 checksum manifest of directories (e.g., http://localhost:8080/subdir/.sha256sums)
+ *
+ * Files can also be served directly from OCI image artifacts, such as those
+ * created by "educates workshop publish", by mapping a path prefix to an image
+ * reference. The image is pulled into a local cache and periodically checked
+ * for updates.
+ *
+ * Files matching rules in .assetsignore files, which use the same syntax as
+ * .gitignore files, are excluded from archives. Symbolic links are followed,
+ * preserved or skipped according to the --symlinks policy, but an archive will
+ * never include files from outside of the data directory.
+ *
+ * Access can be restricted by requiring a static bearer token, or a signed URL
+ * with an expiry time generated using the "sign" subcommand.
+ *
+ * When uploads are enabled, requests authenticated with the bearer token can
+ * modify the data directory:
+ *   - PUT of a single file (e.g., curl -T file.txt http://localhost:8080/subdir/file.txt)
+ *   - POST of a tar, compressed tar or zip archive, which replaces the contents
+ *     of a directory (e.g., curl --data-binary @files.tgz http://localhost:8080/subdir)
+ *   - DELETE of a file or directory (e.g., curl -X DELETE http://localhost:8080/subdir)
+ *
+ * HTTPS is enabled by providing a certificate and key, which are reloaded when
+ * the files change, or by generating a self-signed certificate for a list of
+ * subject alternative names. The certificate of the certificate authority
+ * used to sign a self-signed certificate is written out so that clients can
+ * be configured to trust it.
+ *
+ * Changes to files in the data directory are reported as server-sent events
+ * (e.g., http://localhost:8080/subdir/.events), so clients can fetch only the
+ * files which have been created, modified or deleted.
+ *
+ * Instead of a single data directory, any number of directories can be mounted
+ * under path prefixes using --mount options, or a YAML configuration file of
+ * the form:
+ *
+ *   mounts:
+ *   - prefix: /workshop-a
+ *     path: /data/workshop-a
+ *     readonly: true
+ *     token: secret
+ *     signingKey: key
+ *     symlinks: deny
+ *     formats: ["tar.gz", "zip"]
+ *   images:
+ *   - prefix: /workshop-b
+ *     image: ghcr.io/example/workshop-b-files:latest
+ *     token: secret
+ *     signingKey: key
+ *     symlinks: preserve
+ *
+ * Each mount can have its own bearer token, signing key, symbolic link policy
+ * and list of enabled archive formats, and each image its own bearer token,
+ * signing key and symbolic link policy, which default to the values given on
+ * the command line when not set.
+ *
+ * The paths /healthz and /readyz are reserved for liveness and readiness
+ * probes, and /metrics for Prometheus metrics, none of which require
+ * authentication. Requests are logged as structured JSON access logs. On
+ * SIGTERM the server stops accepting new connections and reports it is not
+ * ready, but waits for in-flight requests such as archive downloads to
+ * complete before exiting.
  */
 
 package main
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
-	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 )
 
-func createTarArchive(dirPath string, writer io.Writer, compress bool) error {
-	var tarWriter *tar.Writer
-	if compress {
-		gzipWriter := gzip.NewWriter(writer)
-		defer gzipWriter.Close()
-		tarWriter = tar.NewWriter(gzipWriter)
-	} else {
-		tarWriter = tar.NewWriter(writer)
+// serveDirectory handles a request for a path under a root directory, serving
+// the archive of a directory if the path ends with an archive suffix, and
+// otherwise serving the static file. When formats is not nil, only archive
+// formats with names in it can be requested.
+func serveDirectory(w http.ResponseWriter, r *http.Request, cache *archiveCache, walker *directoryWalker, formats map[string]bool, requestedPath string) {
+	rootDir := walker.rootDir
+
+	// Create a file server handler to serve static files from the directory.
+	// The request path is replaced with the path relative to the directory.
+	fileServer := http.FileServer(http.Dir(rootDir))
+
+	if requestedPath != r.URL.Path {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = requestedPath
+		r2.URL.RawPath = ""
+		r = r2
 	}
-	defer tarWriter.Close()
-
-	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relPath, err := filepath.Rel(dirPath, path)
-		if err != nil {
-			return err
-		}
-
-		// Create a new tar header
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return err
-		}
-		header.Name = filepath.ToSlash(relPath)
 
-		// Write the header to the tar archive
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
+	// Check if the requested path ends with a suffix for an archive
+	format, dirPath := lookupArchiveFormat(requestedPath)
 
-		// If the file is not a directory, write its content to the tar archive
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	if format == nil {
+		// Serve static files, compressed if accepted by the client
+		filePath := filepath.Join(rootDir, filepath.FromSlash(path.Clean("/"+requestedPath)))
 
-			_, err = io.Copy(tarWriter, file)
-			if err != nil {
-				return err
+		// Ensure the file is not reached via a symbolic link which is not
+		// permitted under the policy for symbolic links
+		if _, err := os.Lstat(filePath); err == nil {
+			if _, allowed := walker.resolve(filePath); !allowed {
+				http.NotFound(w, r)
+				return
 			}
 		}
 
-		return nil
-	})
-}
-
-func createZipArchive(dirPath string, writer io.Writer) error {
-	zipWriter := zip.NewWriter(writer)
-	defer zipWriter.Close()
-
-	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+		if !cache.serveEncodedFile(w, r, filePath) {
+			fileServer.ServeHTTP(w, r)
 		}
+		return
+	}
 
-		relPath, err := filepath.Rel(dirPath, path)
-		if err != nil {
-			return err
-		}
-
-		// Skip adding directory entries as vendir will fail handling it
-		if info.IsDir() {
-			return nil
-		}
-
-		// Create a new zip header
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-		header.Name = filepath.ToSlash(relPath)
-
-		// Write the header to the zip archive
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
-		}
+	// Check if the archive format is enabled
+	if formats != nil && !formats[format.name] {
+		http.NotFound(w, r)
+		return
+	}
 
-		// If the file is not a directory, write its content to the zip archive
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	// Check if the path maps to a directory
+	dirPath = filepath.Join(rootDir, filepath.FromSlash(path.Clean("/"+dirPath)))
 
-			_, err = io.Copy(writer, file)
-			if err != nil {
-				return err
-			}
-		}
+	fileInfo, err := os.Stat(dirPath)
+	if err != nil || !fileInfo.IsDir() {
+		// Serve static files as the path does not map to a directory
+		fileServer.ServeHTTP(w, r)
+		return
+	}
 
-		return nil
-	})
+	// Serve the archive for the requested directory from the cache
+	cache.serveArchive(w, r, walker, dirPath, format)
 }
 
 func main() {
@@ -143,10 +183,54 @@ func main() {
 	var dataDir string
 	var port string
 	var host string
+	var cacheDir string
+	var cacheMaxSize int64
+	var token string
+	var signingKey string
+	var imageMappings []string
+	var imageRefresh time.Duration
+	var registryInsecure bool
+	var symlinks string
+	var allowUploads bool
+	var maxUploadSize int64
+	var logFormat string
+	var shutdownDelay time.Duration
+	var shutdownTimeout time.Duration
+	var tlsCert string
+	var tlsKey string
+	var tlsSelfSigned bool
+	var tlsSANs []string
+	var tlsCAOut string
+	var events bool
+	var mountFlags []string
+	var configFile string
 
 	rootCmd.Flags().StringVarP(&dataDir, "dir", "d", "data", "Directory path containing static files")
 	rootCmd.Flags().StringVarP(&port, "port", "p", "8080", "Port number to listen on")
 	rootCmd.Flags().StringVarP(&host, "host", "H", "localhost", "Host interface to bind the listener socket")
+	rootCmd.Flags().StringVar(&cacheDir, "cache-dir", filepath.Join(os.TempDir(), "assets-server"), "Directory path for caching generated archives, cleared of archives on startup")
+	rootCmd.Flags().Int64Var(&cacheMaxSize, "cache-max-size", 10<<30, "Maximum size in bytes of generated archives and compressed files kept in the cache (0 for no limit)")
+	rootCmd.Flags().StringVar(&token, "token", os.Getenv("ASSETS_SERVER_TOKEN"), "Bearer token required to access files (defaults to $ASSETS_SERVER_TOKEN)")
+	rootCmd.Flags().StringVar(&signingKey, "signing-key", os.Getenv("ASSETS_SERVER_SIGNING_KEY"), "Secret key for validating signed URLs (defaults to $ASSETS_SERVER_SIGNING_KEY)")
+	rootCmd.Flags().StringArrayVar(&imageMappings, "image", nil, "Serve files from an OCI image under a path prefix (format: prefix=reference)")
+	rootCmd.Flags().DurationVar(&imageRefresh, "image-refresh", 5*time.Minute, "Interval after which to check for a new version of an image")
+	rootCmd.Flags().BoolVar(&registryInsecure, "registry-insecure", false, "Allow pulling images from registries over plain HTTP")
+	rootCmd.Flags().StringVar(&symlinks, "symlinks", symlinksFollow, "Policy for symbolic links in archives (follow, preserve or deny)")
+	rootCmd.Flags().BoolVar(&allowUploads, "allow-uploads", false, "Allow files in directories not mounted read-only to be modified using PUT, POST and DELETE (requires a token)")
+	rootCmd.Flags().Int64Var(&maxUploadSize, "max-upload-size", 1<<30, "Maximum size in bytes of an uploaded file or archive")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", "json", "Format of log messages (json or text)")
+	rootCmd.Flags().DurationVar(&shutdownDelay, "shutdown-delay", 0, "Time to keep accepting requests after SIGTERM while reporting not ready")
+	rootCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 60*time.Second, "Maximum time to wait for in-flight requests to complete on shutdown")
+	rootCmd.Flags().StringVar(&tlsCert, "tls-cert", "", "Certificate file for serving HTTPS, reloaded when changed")
+	rootCmd.Flags().StringVar(&tlsKey, "tls-key", "", "Private key file for serving HTTPS, reloaded when changed")
+	rootCmd.Flags().BoolVar(&tlsSelfSigned, "tls-self-signed", false, "Serve HTTPS using a generated self-signed certificate")
+	rootCmd.Flags().StringArrayVar(&tlsSANs, "tls-san", nil, "Host name or IP address to include in the self-signed certificate")
+	rootCmd.Flags().StringVar(&tlsCAOut, "tls-ca-out", "", "File to write the certificate authority for the self-signed certificate to")
+	rootCmd.Flags().BoolVar(&events, "events", true, "Watch served directories and stream notifications of changes")
+	rootCmd.Flags().StringArrayVar(&mountFlags, "mount", nil, "Serve a directory under a path prefix (format: prefix=/path[,readonly])")
+	rootCmd.Flags().StringVarP(&configFile, "config", "c", "", "YAML configuration file defining directories and images to mount")
+
+	rootCmd.AddCommand(newSignCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -158,112 +242,276 @@ func startServer(cmd *cobra.Command, args []string) {
 	dataDir, _ := cmd.Flags().GetString("dir")
 	port, _ := cmd.Flags().GetString("port")
 	host, _ := cmd.Flags().GetString("host")
+	cacheDir, _ := cmd.Flags().GetString("cache-dir")
+	cacheMaxSize, _ := cmd.Flags().GetInt64("cache-max-size")
+	token, _ := cmd.Flags().GetString("token")
+	signingKey, _ := cmd.Flags().GetString("signing-key")
+	imageMappings, _ := cmd.Flags().GetStringArray("image")
+	imageRefresh, _ := cmd.Flags().GetDuration("image-refresh")
+	registryInsecure, _ := cmd.Flags().GetBool("registry-insecure")
+	symlinks, _ := cmd.Flags().GetString("symlinks")
+	allowUploads, _ := cmd.Flags().GetBool("allow-uploads")
+	maxUploadSize, _ := cmd.Flags().GetInt64("max-upload-size")
+	logFormat, _ := cmd.Flags().GetString("log-format")
+	shutdownDelay, _ := cmd.Flags().GetDuration("shutdown-delay")
+	shutdownTimeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+	tlsCert, _ := cmd.Flags().GetString("tls-cert")
+	tlsKey, _ := cmd.Flags().GetString("tls-key")
+	tlsSelfSigned, _ := cmd.Flags().GetBool("tls-self-signed")
+	tlsSANs, _ := cmd.Flags().GetStringArray("tls-san")
+	tlsCAOut, _ := cmd.Flags().GetString("tls-ca-out")
+	events, _ := cmd.Flags().GetBool("events")
+	mountFlags, _ := cmd.Flags().GetStringArray("mount")
+	configFile, _ := cmd.Flags().GetString("config")
+
+	// Configure structured logging, which also applies to messages logged
+	// using the log package
+	switch logFormat {
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	default:
+		fmt.Println("Error: invalid log format", logFormat)
+		return
+	}
 
-	// Check if the data directory exists
-	_, err := os.Stat(dataDir)
-	if err != nil {
-		if os.IsNotExist(err) {
+	// Collect the directories to serve. The data directory is served at the
+	// root unless other directories are mounted and it was not given.
+	var mountConfigs []mountConfig
+	var imageConfigs []imageConfig
+
+	if configFile != "" {
+		config, err := loadServerConfig(configFile)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		mountConfigs = append(mountConfigs, config.Mounts...)
+		imageConfigs = append(imageConfigs, config.Images...)
+	}
+
+	for _, value := range mountFlags {
+		config, err := parseMountFlag(value)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		mountConfigs = append(mountConfigs, config)
+	}
+
+	if len(mountConfigs) == 0 || cmd.Flags().Changed("dir") {
+		// Check if the data directory exists
+		if _, err := os.Stat(dataDir); os.IsNotExist(err) {
 			fmt.Println("Directory", dataDir, "does not exist. Please create the directory and put your static files in it.")
 			return
 		}
+
+		mountConfigs = append(mountConfigs, mountConfig{Prefix: "/", Path: dataDir})
+	}
+
+	// Create the cache for generated archives
+	cache, err := newArchiveCache(cacheDir, cacheMaxSize)
+	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 
-	// Middleware for logging HTTP requests
-	loggingMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			log.Printf("Incoming request: %s %s", r.Method, r.URL.Path)
-			next.ServeHTTP(w, r)
+	// Create the mounts, with settings not given for a mount defaulting to
+	// those from the command line
+	var mounts []*mount
+
+	for _, config := range mountConfigs {
+		if config.Token == "" {
+			config.Token = token
+		}
+		if config.SigningKey == "" {
+			config.SigningKey = signingKey
+		}
+		if config.Symlinks == "" {
+			config.Symlinks = symlinks
+		}
+
+		m, err := newMount(config, mountOptions{
+			cache:         cache,
+			allowUploads:  allowUploads,
+			maxUploadSize: maxUploadSize,
+			events:        events,
 		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		mounts = append(mounts, m)
 	}
 
-	// Create a file server handler to serve static files from the data directory
-	fileServer := http.FileServer(http.Dir(dataDir))
+	if err := sortMounts(mounts); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	// Handle requests for tar, tar.gz, or zip archives of directories
-	http.Handle("/", loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestedPath := r.URL.Path
+	// Create the mappings of path prefixes to images, with settings not
+	// given for an image defaulting to those from the command line
+	for _, value := range imageMappings {
+		config, err := parseImageFlag(value)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
 
-		// Check if the requested path ends with ".tar", ".tar.gz" or ".tgz"
-		if strings.HasSuffix(requestedPath, "/.tar") {
-			// Remove the ".tar" suffix from the path
-			requestedPath = strings.TrimSuffix(requestedPath, ".tar")
+		imageConfigs = append(imageConfigs, config)
+	}
 
-			// Check if the path maps to a directory
-			fileInfo, err := os.Stat(filepath.Join(dataDir, requestedPath))
-			if err != nil || !fileInfo.IsDir() {
-				// Serve static files as the path does not map to a directory
-				fileServer.ServeHTTP(w, r)
-				return
-			}
+	var images []*imageSource
 
-			// Serve the tar archive for the requested directory
-			w.Header().Set("Content-Type", "application/x-tar")
-			w.Header().Set("Content-Disposition", "attachment; filename=\"assets.tar\"")
+	for _, config := range imageConfigs {
+		if config.Token == "" {
+			config.Token = token
+		}
+		if config.SigningKey == "" {
+			config.SigningKey = signingKey
+		}
+		if config.Symlinks == "" {
+			config.Symlinks = symlinks
+		}
 
-			err = createTarArchive(filepath.Join(dataDir, requestedPath), w, false)
-			if err != nil {
-				http.Error(w, "Error creating tar archive", http.StatusInternalServerError)
-				return
-			}
+		source, err := newImageSource(config, imageOptions{
+			cache:    cache,
+			cacheDir: filepath.Join(cacheDir, "images"),
+			ttl:      imageRefresh,
+			insecure: registryInsecure,
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
 			return
-		} else if strings.HasSuffix(requestedPath, "/.tar.gz") || strings.HasSuffix(requestedPath, "/.tgz") {
-			// Remove the ".tar.gz" or ".tgz" suffix from the path
-			requestedPath = strings.TrimSuffix(requestedPath, ".tar.gz")
-			requestedPath = strings.TrimSuffix(requestedPath, ".tgz")
-
-			// Check if the path maps to a directory
-			fileInfo, err := os.Stat(filepath.Join(dataDir, requestedPath))
-			if err != nil || !fileInfo.IsDir() {
-				// Serve static files as the path does not map to a directory
-				fileServer.ServeHTTP(w, r)
-				return
-			}
+		}
 
-			// Serve the tar.gz archive for the requested directory
-			w.Header().Set("Content-Type", "application/gzip")
-			w.Header().Set("Content-Disposition", "attachment; filename=\"assets.tar.gz\"")
+		images = append(images, source)
+	}
 
-			err = createTarArchive(filepath.Join(dataDir, requestedPath), w, true)
-			if err != nil {
-				http.Error(w, "Error creating tar.gz archive", http.StatusInternalServerError)
-				return
-			}
+	// Handle requests for files and archives of directories, either from an
+	// image or from the mount matching the leading path prefix
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if source, _ := lookupImageSource(images, r.URL.Path); source != nil {
+			source.handler.ServeHTTP(w, r)
 			return
-		} else if strings.HasSuffix(requestedPath, "/.zip") {
-			// Remove the ".zip" suffix from the path
-			requestedPath = strings.TrimSuffix(requestedPath, ".zip")
-
-			// Check if the path maps to a directory
-			fileInfo, err := os.Stat(filepath.Join(dataDir, requestedPath))
-			if err != nil || !fileInfo.IsDir() {
-				// Serve static files as the path does not map to a directory
-				fileServer.ServeHTTP(w, r)
-				return
-			}
+		}
+
+		m := lookupMount(mounts, r.URL.Path)
+
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		m.handler.ServeHTTP(w, r)
+	})
+
+	// Handle probes and metrics, which do not require authentication. The
+	// server reports it is not ready once shutdown has been initiated so
+	// that it is removed from service endpoints.
+	var shuttingDown atomic.Bool
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
 
-			// Serve the zip archive for the requested directory
-			w.Header().Set("Content-Type", "application/zip")
-			w.Header().Set("Content-Disposition", "attachment; filename=\"assets.zip\"")
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if shuttingDown.Load() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
 
-			err = createZipArchive(filepath.Join(dataDir, requestedPath), w)
-			if err != nil {
-				http.Error(w, "Error creating zip archive", http.StatusInternalServerError)
+		for _, m := range mounts {
+			if _, err := os.Stat(m.walker.rootDir); err != nil {
+				http.Error(w, "directory for mount "+m.prefix+" not accessible", http.StatusServiceUnavailable)
 				return
 			}
-			return
 		}
 
-		// Serve static files
-		fileServer.ServeHTTP(w, r)
-	})))
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// Configure TLS if enabled. The certificate authority for a self-signed
+	// certificate is kept in the cache directory so it is reused on restart.
+	tlsConfig, err := newTLSConfig(tlsCert, tlsKey, tlsSelfSigned, tlsSANs, filepath.Join(cacheDir, "tls"), tlsCAOut)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
 	// Start the server on the specified host and port
 	addr := host + ":" + port
-	fmt.Println("Server is running on http://" + addr)
-	err = http.ListenAndServe(addr, nil)
-	if err != nil {
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   accessLogMiddleware(mux),
+		TLSConfig: tlsConfig,
+	}
+
+	// Close event streams on shutdown, as they would otherwise never end
+	server.RegisterOnShutdown(func() {
+		for _, m := range mounts {
+			m.close()
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+
+	scheme := "http"
+
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	go func() {
+		if tlsConfig != nil {
+			serverErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+
+	fmt.Println("Server is running on " + scheme + "://" + addr)
+
+	select {
+	case err := <-serverErr:
 		fmt.Println("Error:", err)
+		return
+	case <-ctx.Done():
 	}
+
+	// Drain in-flight requests before exiting, giving up once the timeout
+	// expires. A second signal exits immediately.
+	stop()
+
+	shuttingDown.Store(true)
+
+	log.Printf("Shutting down, waiting for in-flight requests to complete")
+
+	time.Sleep(shutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+		server.Close()
+	}
+
+	if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("Error:", err)
+	}
+
+	log.Printf("Server stopped")
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "assets_server_requests_total",
+		Help: "Number of HTTP requests handled, by method, status code and type of content requested.",
+	}, []string{"method", "code", "format"})
+
+	requestDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "assets_server_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by type of content requested.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 4, 9),
+	}, []string{"format"})
+
+	responseBytesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "assets_server_response_bytes_total",
+		Help: "Number of bytes served in HTTP responses, by type of content requested.",
+	}, []string{"format"})
+
+	requestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "assets_server_requests_in_flight",
+		Help: "Number of HTTP requests currently being handled.",
+	})
+
+	archiveGenerationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "assets_server_archive_generation_seconds",
+		Help:    "Time taken to generate archives which were not already cached, by format.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"format"})
+)
+
+// responseRecorder captures the status code and number of bytes written for
+// a response, so they can be logged and recorded in metrics.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// requestFormat classifies a request by the type of content requested, being
+// the name of the archive format, "events" for change notifications or "file"
+// for static files. Requests which modify files are classified as "upload".
+func requestFormat(r *http.Request) string {
+	if isWriteMethod(r.Method) {
+		return "upload"
+	}
+
+	if strings.HasSuffix(r.URL.Path, eventsSuffix) {
+		return "events"
+	}
+
+	if format, _ := lookupArchiveFormat(r.URL.Path); format != nil {
+		return format.name
+	}
+
+	return "file"
+}
+
+// accessLogMiddleware wraps a handler so that each request is written to the
+// log as a structured access log entry once the response is complete, and
+// recorded in the metrics for requests.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		duration := time.Since(start)
+		format := requestFormat(r)
+
+		requestsTotal.WithLabelValues(r.Method, strconv.Itoa(recorder.status), format).Inc()
+		requestDurationSeconds.WithLabelValues(format).Observe(duration.Seconds())
+		responseBytesTotal.WithLabelValues(format).Add(float64(recorder.bytes))
+
+		slog.Info("request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("proto", r.Proto),
+			slog.Int("status", recorder.status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// mountConfig describes a directory to be served under a path prefix. Any
+// of the authentication and archive settings which are not given default to
+// the values of the corresponding command line options.
+type mountConfig struct {
+	Prefix     string   `json:"prefix"`
+	Path       string   `json:"path"`
+	ReadOnly   bool     `json:"readonly,omitempty"`
+	Token      string   `json:"token,omitempty"`
+	SigningKey string   `json:"signingKey,omitempty"`
+	Symlinks   string   `json:"symlinks,omitempty"`
+	Formats    []string `json:"formats,omitempty"`
+}
+
+// imageConfig describes an OCI image whose files are to be served under a
+// path prefix. As with mounts, authentication and symbolic link settings
+// which are not given default to the values of the command line options.
+type imageConfig struct {
+	Prefix     string `json:"prefix"`
+	Image      string `json:"image"`
+	Token      string `json:"token,omitempty"`
+	SigningKey string `json:"signingKey,omitempty"`
+	Symlinks   string `json:"symlinks,omitempty"`
+}
+
+// serverConfig is the format of the configuration file.
+type serverConfig struct {
+	Mounts []mountConfig `json:"mounts"`
+	Images []imageConfig `json:"images,omitempty"`
+}
+
+// loadServerConfig reads the YAML configuration file.
+func loadServerConfig(name string) (*serverConfig, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &serverConfig{}
+
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", name, err)
+	}
+
+	return config, nil
+}
+
+// parseMountFlag parses a mount given on the command line in the format
+// "prefix=/path[,readonly]".
+func parseMountFlag(value string) (mountConfig, error) {
+	prefix, options, found := strings.Cut(value, "=")
+
+	if !found {
+		return mountConfig{}, fmt.Errorf("invalid mount %q, expected prefix=/path[,readonly]", value)
+	}
+
+	parts := strings.Split(options, ",")
+
+	config := mountConfig{Prefix: prefix, Path: parts[0]}
+
+	for _, option := range parts[1:] {
+		switch option {
+		case "readonly":
+			config.ReadOnly = true
+		default:
+			return mountConfig{}, fmt.Errorf("invalid mount %q, unknown option %q", value, option)
+		}
+	}
+
+	return config, nil
+}
+
+// mount serves files and archives from a directory under a path prefix, with
+// its own authentication and archive settings.
+type mount struct {
+	prefix   string
+	walker   *directoryWalker
+	formats  map[string]bool
+	uploader *uploader
+	notifier *changeNotifier
+	handler  http.Handler
+}
+
+// mountOptions holds the server wide options which apply to every mount.
+type mountOptions struct {
+	cache         *archiveCache
+	allowUploads  bool
+	maxUploadSize int64
+	events        bool
+}
+
+func newMount(config mountConfig, options mountOptions) (*mount, error) {
+	prefix := "/" + strings.Trim(config.Prefix, "/")
+
+	if config.Path == "" {
+		return nil, fmt.Errorf("mount %s has no directory path", prefix)
+	}
+
+	info, err := os.Stat(config.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("directory %s for mount %s does not exist", config.Path, prefix)
+		}
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("path %s for mount %s is not a directory", config.Path, prefix)
+	}
+
+	rootDir, err := filepath.Abs(config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	walker, err := newDirectoryWalker(rootDir, config.Symlinks)
+	if err != nil {
+		return nil, fmt.Errorf("mount %s: %v", prefix, err)
+	}
+
+	m := &mount{prefix: prefix, walker: walker}
+
+	// Restrict the archive formats which can be requested if a list of
+	// formats was given.
+	if len(config.Formats) != 0 {
+		m.formats = map[string]bool{}
+
+		for _, name := range config.Formats {
+			if lookupArchiveFormatByName(name) == nil {
+				return nil, fmt.Errorf("mount %s: unknown archive format %q", prefix, name)
+			}
+			m.formats[name] = true
+		}
+	}
+
+	// Uploads require the bearer token so that anonymous clients cannot
+	// modify files.
+	if options.allowUploads && !config.ReadOnly {
+		if config.Token == "" {
+			return nil, fmt.Errorf("mount %s: uploads require a bearer token", prefix)
+		}
+
+		m.uploader, err = newUploader(rootDir, options.maxUploadSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Watch the directory for changes to report to clients. The mount can
+	// still be served without this if the limit on watches has been reached.
+	if options.events {
+		m.notifier, err = newChangeNotifier(walker)
+		if err != nil {
+			log.Printf("Error watching %s, change notifications for mount %s disabled: %v", rootDir, prefix, err)
+		}
+	}
+
+	auth := &authenticator{token: config.Token, signingKey: []byte(config.SigningKey)}
+
+	m.handler = auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.serveHTTP(w, r, options.cache)
+	}))
+
+	return m, nil
+}
+
+// relativePath returns the part of a request path under the mount prefix.
+func (m *mount) relativePath(requestPath string) string {
+	if m.prefix == "/" {
+		return requestPath
+	}
+
+	if requestPath == m.prefix {
+		return "/"
+	}
+
+	return strings.TrimPrefix(requestPath, m.prefix)
+}
+
+func (m *mount) serveHTTP(w http.ResponseWriter, r *http.Request, cache *archiveCache) {
+	requestedPath := m.relativePath(r.URL.Path)
+
+	if isWriteMethod(r.Method) {
+		if m.uploader == nil {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		m.uploader.serveHTTP(w, r, requestedPath)
+		return
+	}
+
+	if strings.HasSuffix(requestedPath, eventsSuffix) && r.Method == http.MethodGet {
+		if m.notifier == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		m.notifier.serveEvents(w, r, requestedPath)
+		return
+	}
+
+	serveDirectory(w, r, cache, m.walker, m.formats, requestedPath)
+}
+
+// close stops watching the directory for changes.
+func (m *mount) close() {
+	if m.notifier != nil {
+		m.notifier.close()
+	}
+}
+
+// sortMounts orders mounts so that those with longer prefixes come first, so
+// that a mount nested under the prefix of another mount takes precedence.
+func sortMounts(mounts []*mount) error {
+	sort.Slice(mounts, func(i, j int) bool {
+		if len(mounts[i].prefix) != len(mounts[j].prefix) {
+			return len(mounts[i].prefix) > len(mounts[j].prefix)
+		}
+		return mounts[i].prefix < mounts[j].prefix
+	})
+
+	for i := 1; i < len(mounts); i++ {
+		if mounts[i].prefix == mounts[i-1].prefix {
+			return fmt.Errorf("more than one mount for prefix %s", mounts[i].prefix)
+		}
+	}
+
+	return nil
+}
+
+// lookupMount returns the mount whose prefix matches the request path.
+func lookupMount(mounts []*mount, requestPath string) *mount {
+	for _, m := range mounts {
+		if m.prefix == "/" || requestPath == m.prefix || strings.HasPrefix(requestPath, m.prefix+"/") {
+			return m
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"golang.org/x/sys/unix"
+)
+
+// exchangeDirectories atomically swaps two existing directories, such that
+// any request for either path sees one directory or the other but never a
+// missing directory. Where the file system doesn't support exchanging paths,
+// it falls back to moving the directories one at a time.
+func exchangeDirectories(oldPath string, newPath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_EXCHANGE)
+
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		log.Printf("Atomic exchange of directories not supported, replacing %s non-atomically", newPath)
+
+		return swapDirectories(oldPath, newPath)
+	}
+
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+// exchangeDirectories swaps two existing directories. Exchanging paths in a
+// single operation is only supported on Linux, so elsewhere the directories
+// are moved one at a time.
+func exchangeDirectories(oldPath string, newPath string) error {
+	return swapDirectories(oldPath, newPath)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the inode number and change time of a file, which,
+// unlike the modification time, cannot be set back to an earlier value, so
+// that a file rewritten in place with its size and modification time kept
+// the same, such as by "rsync -t", is still seen to have changed.
+func fileIdentity(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%d.%d.%d", stat.Ino, stat.Ctim.Sec, stat.Ctim.Nsec)
+}
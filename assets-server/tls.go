@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// certificateCheckInterval is the minimum time between checks of whether the
+// certificate files have changed.
+const certificateCheckInterval = 5 * time.Second
+
+// certificateReloader serves a certificate loaded from PEM files, reloading
+// it when the files change so that a renewed certificate is picked up without
+// restarting the server. The files are checked when a TLS handshake occurs,
+// at most once per check interval.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+	checked     time.Time
+}
+
+func newCertificateReloader(certFile string, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// reload loads the certificate if either of the files has been modified since
+// it was last loaded. Must be called with the mutex held, except when called
+// from the constructor.
+func (c *certificateReloader) reload() error {
+	var modTimes [2]time.Time
+
+	for i, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	c.checked = time.Now()
+
+	if c.certificate != nil && modTimes == c.modTimes {
+		return nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if c.certificate != nil {
+		log.Printf("Reloaded TLS certificate from %s", c.certFile)
+	}
+
+	c.certificate = &certificate
+	c.modTimes = modTimes
+
+	return nil
+}
+
+func (c *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if time.Since(c.checked) > certificateCheckInterval {
+		// Keep serving the existing certificate if the files are missing or
+		// only partially written while being replaced.
+		if err := c.reload(); err != nil {
+			log.Printf("Error reloading TLS certificate from %s: %v", c.certFile, err)
+		}
+	}
+
+	return c.certificate, nil
+}
+
+// generateSelfSignedCertificate creates a server certificate for the subject
+// alternative names, which can be host names or IP addresses, signed by a
+// certificate authority held in the TLS directory. The certificate authority
+// is created the first time and reused after that, so clients which have been
+// configured to trust it continue to do so across restarts. The certificate
+// of the certificate authority is written to caFile.
+func generateSelfSignedCertificate(tlsDir string, caFile string, sans []string) (*tls.Certificate, error) {
+	if err := os.MkdirAll(tlsDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	caCertificate, caKey, err := loadOrCreateCertificateAuthority(filepath.Join(tlsDir, "ca.crt"), filepath.Join(tlsDir, "ca.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writePEMFile(caFile, "CERTIFICATE", caCertificate.Raw, 0o644); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: sans[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, caCertificate, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certificateDER, caCertificate.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+func loadOrCreateCertificateAuthority(certFile string, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if pair, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		certificate, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+
+		if ok && time.Now().Before(certificate.NotAfter.AddDate(0, -1, 0)) {
+			return certificate, key, nil
+		}
+	}
+
+	log.Printf("Generating certificate authority in %s", filepath.Dir(certFile))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "assets-server CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(certificateDER)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writePEMFile(keyFile, "EC PRIVATE KEY", keyDER, 0o600); err != nil {
+		return nil, nil, err
+	}
+
+	if err := writePEMFile(certFile, "CERTIFICATE", certificateDER, 0o644); err != nil {
+		return nil, nil, err
+	}
+
+	return certificate, key, nil
+}
+
+// writePEMFile writes a PEM encoded block to a file, replacing it atomically
+// so a reader never sees a partially written file.
+func writePEMFile(name string, blockType string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	err = pem.Encode(file, &pem.Block{Type: blockType, Bytes: data})
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(file.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+// newTLSConfig returns the TLS configuration for the server, or nil if TLS is
+// not enabled. Either a certificate and key must be provided, or a self-signed
+// certificate generated for the subject alternative names.
+func newTLSConfig(certFile string, keyFile string, selfSigned bool, sans []string, tlsDir string, caFile string) (*tls.Config, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("both --tls-cert and --tls-key must be provided")
+	}
+
+	if selfSigned && certFile != "" {
+		return nil, fmt.Errorf("--tls-self-signed cannot be used with --tls-cert and --tls-key")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch {
+	case certFile != "":
+		reloader, err := newCertificateReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetCertificate = reloader.getCertificate
+	case selfSigned:
+		if len(sans) == 0 {
+			sans = []string{"localhost", "127.0.0.1", "::1"}
+		}
+
+		if caFile == "" {
+			caFile = filepath.Join(tlsDir, "ca.crt")
+		}
+
+		certificate, err := generateSelfSignedCertificate(tlsDir, caFile, sans)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("Generated self-signed certificate for %v, trust the certificate authority in %s", sans, caFile)
+
+		config.Certificates = []tls.Certificate{*certificate}
+	default:
+		return nil, nil
+	}
+
+	return config, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// uploadStagingPrefix is the prefix for the names of temporary files and
+// directories created while an upload is in progress. These are created in
+// the same directory as the target so they can be renamed into place, and are
+// excluded from archives.
+const uploadStagingPrefix = ".assets-upload-"
+
+// uploader handles requests which modify files under a root directory. A
+// single file is written using PUT, a directory is replaced with the contents
+// of a tar or zip archive using POST, and a file or directory is removed using
+// DELETE. Nothing is ever written outside of the root directory.
+type uploader struct {
+	rootDir string
+	maxSize int64
+
+	mutex sync.Mutex
+}
+
+func newUploader(rootDir string, maxSize int64) (*uploader, error) {
+	rootDir, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &uploader{rootDir: rootDir, maxSize: maxSize}, nil
+}
+
+// isWriteMethod checks whether a request method is one handled by uploader.
+func isWriteMethod(method string) bool {
+	return method == http.MethodPut || method == http.MethodPost || method == http.MethodDelete
+}
+
+func (u *uploader) serveHTTP(w http.ResponseWriter, r *http.Request, requestedPath string) {
+	relPath := strings.TrimPrefix(path.Clean("/"+requestedPath), "/")
+
+	if relPath == "" {
+		http.Error(w, "Forbidden: cannot modify the root directory", http.StatusForbidden)
+		return
+	}
+
+	if format, _ := lookupArchiveFormat("/" + relPath); format != nil {
+		http.Error(w, "Bad Request: path conflicts with "+format.name+" archive suffix", http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasSuffix("/"+relPath, eventsSuffix) {
+		http.Error(w, "Bad Request: path conflicts with events suffix", http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasPrefix(path.Base(relPath), uploadStagingPrefix) {
+		http.Error(w, "Bad Request: path uses reserved name prefix", http.StatusBadRequest)
+		return
+	}
+
+	targetPath := filepath.Join(u.rootDir, filepath.FromSlash(relPath))
+
+	var status int
+	var err error
+
+	switch r.Method {
+	case http.MethodPut:
+		status, err = u.putFile(r, relPath, targetPath)
+	case http.MethodPost:
+		status, err = u.putArchive(r, relPath, targetPath)
+	case http.MethodDelete:
+		status, err = u.delete(relPath, targetPath)
+	}
+
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+
+		if errors.As(err, &maxBytesError) || errors.Is(err, errArchiveTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		log.Printf("Error handling %s of %s: %v", r.Method, requestedPath, err)
+		http.Error(w, http.StatusText(status)+": "+err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(status)
+}
+
+// checkParentDirectories ensures that the parent directories of a target path
+// already exist and are not reached via a symbolic link.
+func (u *uploader) checkParentDirectories(relPath string, targetPath string) error {
+	parentPath, err := filepath.EvalSymlinks(filepath.Dir(targetPath))
+	if err != nil {
+		return err
+	}
+
+	if parentPath != filepath.Join(u.rootDir, filepath.FromSlash(path.Dir(relPath))) {
+		return fmt.Errorf("parent directory is a symbolic link")
+	}
+
+	return nil
+}
+
+// putFile writes the request body to a temporary file which is then renamed
+// over the target path, so a partially written file is never served.
+func (u *uploader) putFile(r *http.Request, relPath string, targetPath string) (int, error) {
+	if err := makeParentDirectories(u.rootDir, relPath); err != nil {
+		return http.StatusConflict, err
+	}
+
+	status := http.StatusCreated
+
+	if info, err := os.Lstat(targetPath); err == nil {
+		if info.IsDir() {
+			return http.StatusConflict, fmt.Errorf("path is a directory")
+		}
+		status = http.StatusNoContent
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(targetPath), uploadStagingPrefix+"*")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, http.MaxBytesReader(nil, r.Body, u.maxSize))
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err := os.Rename(file.Name(), targetPath); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	log.Printf("Uploaded file %s", relPath)
+
+	return status, nil
+}
+
+// putArchive unpacks the tar or zip archive in the request body into a
+// staging directory, then swaps the staging directory with the target
+// directory. Tar archives may be compressed using gzip, zstd or xz.
+func (u *uploader) putArchive(r *http.Request, relPath string, targetPath string) (int, error) {
+	if err := makeParentDirectories(u.rootDir, relPath); err != nil {
+		return http.StatusConflict, err
+	}
+
+	// Fail early if the target is not a directory, rather than only after
+	// the archive has been unpacked. This is checked again below.
+	if info, err := os.Lstat(targetPath); err == nil && !info.IsDir() {
+		return http.StatusConflict, fmt.Errorf("path is not a directory")
+	}
+
+	parentDir := filepath.Dir(targetPath)
+
+	stagingDir, err := os.MkdirTemp(parentDir, uploadStagingPrefix+"*")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	defer os.RemoveAll(stagingDir)
+
+	if err := os.Chmod(stagingDir, 0o755); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err := u.extractArchive(http.MaxBytesReader(nil, r.Body, u.maxSize), parentDir, stagingDir); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// Swap the staging directory with any existing directory in a single
+	// operation, so that requests never see the directory missing. The
+	// previous content is left in the staging directory and discarded.
+	// Concurrent uploads and deletes are serialized, and whether the target
+	// exists is only decided while holding the lock, so that neither can
+	// replace or remove the directory the other is putting in place.
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if err := u.checkParentDirectories(relPath, targetPath); err != nil {
+		return http.StatusConflict, err
+	}
+
+	status := http.StatusCreated
+
+	if info, err := os.Lstat(targetPath); err == nil {
+		if !info.IsDir() {
+			return http.StatusConflict, fmt.Errorf("path is not a directory")
+		}
+		status = http.StatusNoContent
+	} else if !os.IsNotExist(err) {
+		return http.StatusInternalServerError, err
+	}
+
+	if status == http.StatusNoContent {
+		if err := exchangeDirectories(stagingDir, targetPath); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	} else if err := os.Rename(stagingDir, targetPath); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	log.Printf("Unpacked archive into %s", relPath)
+
+	return status, nil
+}
+
+// extractArchive detects the type of archive from its leading bytes and
+// unpacks it into the staging directory. A zip archive must be spooled to a
+// temporary file first, as its directory is located at the end of the file.
+// What is unpacked is limited to the maximum upload size, as a compressed
+// archive can expand to far larger than the request body.
+func (u *uploader) extractArchive(body io.Reader, parentDir string, stagingDir string) error {
+	reader := bufio.NewReader(body)
+
+	limit := newExtractLimit(u.maxSize)
+
+	magic, _ := reader.Peek(6)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")) || bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		file, err := os.CreateTemp(parentDir, uploadStagingPrefix+"*")
+		if err != nil {
+			return err
+		}
+
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		size, err := io.Copy(file, reader)
+		if err != nil {
+			return err
+		}
+
+		return extractZipArchive(file, size, stagingDir, limit)
+	case bytes.HasPrefix(magic, []byte("\x1f\x8b")):
+		decompressor, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+
+		defer decompressor.Close()
+
+		return extractTarArchive(decompressor, stagingDir, limit)
+	case bytes.HasPrefix(magic, []byte("\x28\xb5\x2f\xfd")):
+		decompressor, err := zstd.NewReader(reader)
+		if err != nil {
+			return err
+		}
+
+		defer decompressor.Close()
+
+		return extractTarArchive(decompressor, stagingDir, limit)
+	case bytes.HasPrefix(magic, []byte("\xfd7zXZ\x00")):
+		decompressor, err := xz.NewReader(reader)
+		if err != nil {
+			return err
+		}
+
+		return extractTarArchive(decompressor, stagingDir, limit)
+	}
+
+	return extractTarArchive(reader, stagingDir, limit)
+}
+
+// swapDirectories swaps two existing directories by moving them one at a time,
+// for where they cannot be exchanged in a single operation. There is a brief
+// window during which the second path does not exist.
+func swapDirectories(oldPath string, newPath string) error {
+	previousPath := oldPath + ".previous"
+
+	if err := os.Rename(newPath, previousPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		os.Rename(previousPath, newPath)
+		return err
+	}
+
+	return os.Rename(previousPath, oldPath)
+}
+
+// delete removes a file or directory. A symbolic link is removed rather than
+// what it refers to.
+func (u *uploader) delete(relPath string, targetPath string) (int, error) {
+	if _, err := os.Lstat(targetPath); err != nil {
+		return http.StatusNotFound, fmt.Errorf("path does not exist")
+	}
+
+	if err := u.checkParentDirectories(relPath, targetPath); err != nil {
+		return http.StatusConflict, err
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if err := os.RemoveAll(targetPath); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	log.Printf("Deleted %s", relPath)
+
+	return http.StatusNoContent, nil
+}
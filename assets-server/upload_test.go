@@ -0,0 +1,340 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveEntry describes an entry to add to a test archive. An entry with a
+// link name is a symbolic link, one whose name ends in a slash a directory,
+// and any other a regular file holding the content.
+type archiveEntry struct {
+	name     string
+	linkname string
+	content  string
+}
+
+func newTarArchive(t *testing.T, entries []archiveEntry) []byte {
+	var buffer bytes.Buffer
+
+	writer := tar.NewWriter(&buffer)
+
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644}
+
+		switch {
+		case entry.linkname != "":
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.linkname
+		case entry.name[len(entry.name)-1] == '/':
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0o755
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.content))
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := writer.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func newZipArchive(t *testing.T, entries []archiveEntry) []byte {
+	var buffer bytes.Buffer
+
+	writer := zip.NewWriter(&buffer)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name}
+		content := entry.content
+
+		if entry.linkname != "" {
+			header.SetMode(os.ModeSymlink | 0o777)
+			content = entry.linkname
+		}
+
+		file, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestExtractTarget(t *testing.T) {
+	rootPath := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(rootPath, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("dir", filepath.Join(rootPath, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(rootPath, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		valid  bool
+	}{
+		{"file", "file", true},
+		{"nested", "dir/a/b", true},
+		{"root", ".", true},
+		{"leading slash", "/dir/a", true},
+		{"parent within root", "dir/../a", true},
+		{"parent", "..", false},
+		{"parent prefix", "../a", false},
+		{"parent after directory", "dir/../../a", false},
+		{"symbolic link parent", "link/a", false},
+		{"file parent", "file/a", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target, err := extractTarget(rootPath, test.target)
+
+			if test.valid && err != nil {
+				t.Fatalf("expected path to be valid, got %v", err)
+			}
+
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected path to be rejected, got %s", target)
+				}
+				return
+			}
+
+			if target != "" && !isWithinDirectory(rootPath, target) {
+				t.Errorf("expected path within %s, got %s", rootPath, target)
+			}
+		})
+	}
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		valid   bool
+	}{
+		{"files", []archiveEntry{{name: "a/"}, {name: "a/b", content: "b"}, {name: "c", content: "c"}}, true},
+		{"traversal", []archiveEntry{{name: "../a", content: "a"}}, false},
+		{"nested traversal", []archiveEntry{{name: "a/../../b", content: "b"}}, false},
+		{"relative symbolic link", []archiveEntry{{name: "a/b", content: "b"}, {name: "c", linkname: "a/b"}}, true},
+		{"absolute symbolic link", []archiveEntry{{name: "a", linkname: "/etc/passwd"}}, false},
+		{"symbolic link outside", []archiveEntry{{name: "a", linkname: "../outside"}}, false},
+		{"nested symbolic link outside", []archiveEntry{{name: "a/b", linkname: "../../outside"}}, false},
+		{"symbolic link to root", []archiveEntry{{name: "a/b", linkname: ".."}}, true},
+		{"write through symbolic link", []archiveEntry{{name: "a/"}, {name: "b", linkname: "a"}, {name: "b/c", content: "c"}}, false},
+		{"write through symbolic link to parent", []archiveEntry{{name: "a/b", linkname: ".."}, {name: "a/b/c", content: "c"}}, false},
+	}
+
+	formats := []struct {
+		name    string
+		extract func(t *testing.T, entries []archiveEntry, dirPath string) error
+	}{
+		{"tar", func(t *testing.T, entries []archiveEntry, dirPath string) error {
+			return extractTarArchive(bytes.NewReader(newTarArchive(t, entries)), dirPath, newExtractLimit(1<<20))
+		}},
+		{"zip", func(t *testing.T, entries []archiveEntry, dirPath string) error {
+			data := newZipArchive(t, entries)
+			return extractZipArchive(bytes.NewReader(data), int64(len(data)), dirPath, newExtractLimit(1<<20))
+		}},
+	}
+
+	for _, format := range formats {
+		for _, test := range tests {
+			t.Run(format.name+"/"+test.name, func(t *testing.T) {
+				parentDir := t.TempDir()
+				stagingDir := filepath.Join(parentDir, "staging")
+
+				if err := os.Mkdir(stagingDir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				err := format.extract(t, test.entries, stagingDir)
+
+				if test.valid && err != nil {
+					t.Fatalf("expected archive to be unpacked, got %v", err)
+				}
+
+				if !test.valid && err == nil {
+					t.Fatal("expected archive to be rejected")
+				}
+
+				entries, err := os.ReadDir(parentDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != 1 {
+					t.Errorf("expected nothing written outside of staging directory, got %d entries", len(entries))
+				}
+			})
+		}
+	}
+}
+
+func TestExtractLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   *extractLimit
+		entries []archiveEntry
+		valid   bool
+	}{
+		{"within limits", &extractLimit{maxSize: 1 << 20, maxEntries: 2}, []archiveEntry{{name: "a", content: "a"}, {name: "b", content: "b"}}, true},
+		{"no limit", nil, []archiveEntry{{name: "a", content: string(make([]byte, 1<<20))}}, true},
+		{"too large", &extractLimit{maxSize: 1 << 20, maxEntries: 2}, []archiveEntry{{name: "a", content: string(make([]byte, 1<<20))}}, false},
+		{"too many entries", &extractLimit{maxSize: 1 << 20, maxEntries: 2}, []archiveEntry{{name: "a/"}, {name: "a/b"}, {name: "a/c"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := extractTarArchive(bytes.NewReader(newTarArchive(t, test.entries)), t.TempDir(), test.limit)
+
+			if test.valid && err != nil {
+				t.Fatalf("expected archive to be unpacked, got %v", err)
+			}
+
+			if !test.valid && !errors.Is(err, errArchiveTooLarge) {
+				t.Fatalf("expected errArchiveTooLarge, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExchangeDirectories(t *testing.T) {
+	exchanges := []struct {
+		name     string
+		exchange func(oldPath string, newPath string) error
+	}{
+		{"exchange", exchangeDirectories},
+		{"swap", swapDirectories},
+	}
+
+	for _, exchange := range exchanges {
+		t.Run(exchange.name, func(t *testing.T) {
+			dirPath := t.TempDir()
+
+			for _, name := range []string{"old", "new"} {
+				if err := os.Mkdir(filepath.Join(dirPath, name), 0o755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(filepath.Join(dirPath, name, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := exchange.exchange(filepath.Join(dirPath, "old"), filepath.Join(dirPath, "new")); err != nil {
+				t.Fatalf("unable to exchange directories: %v", err)
+			}
+
+			for name, content := range map[string]string{"old": "new", "new": "old"} {
+				if _, err := os.Stat(filepath.Join(dirPath, name, content)); err != nil {
+					t.Errorf("expected %s to hold contents of %s: %v", name, content, err)
+				}
+			}
+
+			entries, err := os.ReadDir(dirPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != 2 {
+				t.Errorf("expected only the two directories to remain, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestUploaderArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(rootDir string) error
+		entries []archiveEntry
+		status  int
+	}{
+		{"new directory", nil, []archiveEntry{{name: "a", content: "a"}}, http.StatusCreated},
+		{"existing directory", func(rootDir string) error {
+			return os.Mkdir(filepath.Join(rootDir, "target"), 0o755)
+		}, []archiveEntry{{name: "a", content: "a"}}, http.StatusNoContent},
+		{"existing file", func(rootDir string) error {
+			return os.WriteFile(filepath.Join(rootDir, "target"), nil, 0o644)
+		}, []archiveEntry{{name: "a", content: "a"}}, http.StatusConflict},
+		{"too large", nil, []archiveEntry{{name: "a", content: string(make([]byte, 2<<20))}}, http.StatusRequestEntityTooLarge},
+		{"invalid archive", nil, []archiveEntry{{name: "../a", content: "a"}}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+
+			if test.setup != nil {
+				if err := test.setup(rootDir); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			u, err := newUploader(rootDir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/target", bytes.NewReader(newTarArchive(t, test.entries)))
+			w := httptest.NewRecorder()
+
+			u.serveHTTP(w, r, "/target")
+
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+
+			if test.status == http.StatusCreated || test.status == http.StatusNoContent {
+				if _, err := os.Stat(filepath.Join(rootDir, "target", "a")); err != nil {
+					t.Errorf("expected archive to be unpacked into target: %v", err)
+				}
+			}
+
+			entries, err := os.ReadDir(rootDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) > 1 {
+				t.Errorf("expected staging directories to be removed, got %d entries", len(entries))
+			}
+		})
+	}
+}
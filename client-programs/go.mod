@@ -8,6 +8,8 @@ replace github.com/google/cel-go => github.com/google/cel-go v0.22.1
 
 replace github.com/docker/docker => github.com/docker/docker v27.5.1+incompatible
 
+replace github.com/educates/educates-training-platform/tunnel-manager => ../tunnel-manager
+
 require (
 	carvel.dev/imgpkg v0.44.2
 	carvel.dev/kapp v0.64.0
@@ -22,6 +24,7 @@ require (
 	// Version compabitility: https://github.com/moby/moby/blob/master/docs/api/version-history.md
 	github.com/docker/docker v28.0.1+incompatible
 	github.com/docker/go-connections v0.5.0
+	github.com/educates/educates-training-platform/tunnel-manager v0.0.0-00010101000000-000000000000
 	github.com/go-logr/logr v1.4.2
 	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
@@ -120,6 +123,7 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.26.3 // indirect
 	github.com/hashicorp/go-version v1.7.0 // indirect
+	github.com/hashicorp/yamux v0.1.2 // indirect
 	github.com/imdario/mergo v0.3.16 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
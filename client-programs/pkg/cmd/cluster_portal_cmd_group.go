@@ -25,6 +25,8 @@ func (p *ProjectInfo) NewClusterPortalCmdGroup() *cobra.Command {
 				p.NewClusterPortalOpenCmd(),
 				p.NewClusterPortalDeleteCmd(),
 				p.NewClusterPortalPasswordCmd(),
+				p.NewClusterPortalLoginCmd(),
+				p.NewClusterPortalLogoutCmd(),
 			},
 		},
 	}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+type ClusterPortalLoginOptions struct {
+	KubeconfigOptions
+	Portal string
+	Force  bool
+}
+
+func (o *ClusterPortalLoginOptions) Run(cmd *cobra.Command) error {
+	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+
+	if err != nil {
+		return err
+	}
+
+	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
+		clusterConfig,
+		o.Portal,
+	)
+
+	err = catalogApiRequester.LoginWithCachedToken(cmd.Context(), o.Force)
+
+	if err != nil {
+		return errors.Wrap(err, "failed to login to training portal")
+	}
+
+	fmt.Println("Portal:", catalogApiRequester.PortalUrl)
+	fmt.Println("Expires:", catalogApiRequester.Expires().Local().Format(time.RFC3339))
+
+	return nil
+}
+
+func (p *ProjectInfo) NewClusterPortalLoginCmd() *cobra.Command {
+	var o ClusterPortalLoginOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "login",
+		Short: "Login to training portal in Kubernetes",
+		Long: "Login to the REST API of the training portal, saving the access token " +
+			"so it can be used by later commands. The saved access token is refreshed " +
+			"when it expires, until revoked using \"educates cluster portal logout\".",
+		RunE: func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVar(
+		&o.Kubeconfig,
+		"kubeconfig",
+		"",
+		"kubeconfig file to use instead of $KUBECONFIG or $HOME/.kube/config",
+	)
+	c.Flags().StringVar(
+		&o.Context,
+		"context",
+		"",
+		"Context to use from Kubeconfig",
+	)
+	c.Flags().StringVarP(
+		&o.Portal,
+		"portal",
+		"p",
+		"educates-cli",
+		"name to be used for training portal and workshop name prefixes",
+	)
+	c.Flags().BoolVar(
+		&o.Force,
+		"force",
+		false,
+		"obtain a new access token even if the saved one has not expired",
+	)
+
+	return c
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+type ClusterPortalLogoutOptions struct {
+	KubeconfigOptions
+	Portal string
+}
+
+func (o *ClusterPortalLogoutOptions) Run(cmd *cobra.Command) error {
+	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+
+	if err != nil {
+		return err
+	}
+
+	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
+		clusterConfig,
+		o.Portal,
+	)
+
+	err = catalogApiRequester.Logout(cmd.Context())
+
+	if err != nil {
+		return errors.Wrap(err, "failed to logout from training portal")
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewClusterPortalLogoutCmd() *cobra.Command {
+	var o ClusterPortalLogoutOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "logout",
+		Short: "Logout from training portal in Kubernetes",
+		Long: "Revoke the access token saved for the training portal by an earlier " +
+			"command and remove it from disk.",
+		RunE: func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVar(
+		&o.Kubeconfig,
+		"kubeconfig",
+		"",
+		"kubeconfig file to use instead of $KUBECONFIG or $HOME/.kube/config",
+	)
+	c.Flags().StringVar(
+		&o.Context,
+		"context",
+		"",
+		"Context to use from Kubeconfig",
+	)
+	c.Flags().StringVarP(
+		&o.Portal,
+		"portal",
+		"p",
+		"educates-cli",
+		"name to be used for training portal and workshop name prefixes",
+	)
+
+	return c
+}
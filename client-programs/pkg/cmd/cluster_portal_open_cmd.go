@@ -3,8 +3,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os/exec"
 	"runtime"
@@ -13,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -84,25 +83,42 @@ func (o *ClusterPortalOpenOptions) Run() error {
 		return string(spinners[iteration%len(spinners)])
 	}
 
-	for i := 1; i < 300; i++ {
-		fmt.Printf("\r[%s] Waiting...", spinner(i))
+	// Show a spinner while waiting, stopping it before any further output.
 
-		time.Sleep(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
 
-		resp, err := http.Get(rootUrl)
+	waiting := make(chan struct{})
+	stopped := make(chan struct{})
 
-		if err != nil || resp.StatusCode == 503 {
-			continue
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for i := 1; ; i++ {
+			fmt.Printf("\r[%s] Waiting...", spinner(i))
+
+			select {
+			case <-waiting:
+				return
+			case <-ticker.C:
+			}
 		}
+	}()
 
-		defer resp.Body.Close()
-		io.ReadAll(resp.Body)
+	err = educatesrestapi.NewPortalClient(rootUrl, "").WaitUntilReady(ctx)
 
-		break
-	}
+	close(waiting)
+	<-stopped
 
 	fmt.Print("\r              \r")
 
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("Opening training portal %s.\n", targetUrl)
 
 	switch runtime.GOOS {
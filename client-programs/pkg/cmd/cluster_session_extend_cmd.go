@@ -5,8 +5,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
-	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
 )
 
 type ClusterSessionExtendOptions struct {
@@ -15,26 +13,19 @@ type ClusterSessionExtendOptions struct {
 	Name   string
 }
 
-func (o *ClusterSessionExtendOptions) Run() error {
-	var err error
-
-	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+func (o *ClusterSessionExtendOptions) Run(cmd *cobra.Command) error {
+	catalogApiRequester, _, err := o.catalogRequester(o.Portal)
 
 	if err != nil {
 		return err
 	}
 
-	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
-		clusterConfig,
-		o.Portal,
-	)
-	logout, err := catalogApiRequester.Login()
-	defer logout()
+	err = catalogApiRequester.Login(cmd.Context())
 	if err != nil {
 		return errors.Wrap(err, "failed to login to training portal")
 	}
 
-	details, err := catalogApiRequester.ExtendWorkshopSession(o.Name)
+	details, err := catalogApiRequester.ExtendWorkshopSession(cmd.Context(), o.Name)
 	if err != nil {
 		return err
 	}
@@ -56,7 +47,7 @@ func (p *ProjectInfo) NewClusterSessionExtendCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		Use:   "extend NAME",
 		Short: "Extend duration of session in Kubernetes",
-		RunE:  func(_ *cobra.Command, args []string) error { o.Name = args[0]; return o.Run() },
+		RunE:  func(cmd *cobra.Command, args []string) error { o.Name = args[0]; return o.Run(cmd) },
 	}
 
 	c.Flags().StringVar(
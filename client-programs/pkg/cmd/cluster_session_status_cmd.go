@@ -5,8 +5,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
-	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
 )
 
 type ClusterSessionStatusOptions struct {
@@ -15,22 +13,19 @@ type ClusterSessionStatusOptions struct {
 	Name   string
 }
 
-func (o *ClusterSessionStatusOptions) Run() error {
-	var err error
+func (o *ClusterSessionStatusOptions) Run(cmd *cobra.Command) error {
+	catalogApiRequester, _, err := o.catalogRequester(o.Portal)
 
-	clusterConfig := cluster.NewClusterConfig(o.Kubeconfig, o.Context)
+	if err != nil {
+		return err
+	}
 
-	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
-		clusterConfig,
-		o.Portal,
-	)
-	logout, err := catalogApiRequester.Login()
-	defer logout()
+	err = catalogApiRequester.Login(cmd.Context())
 	if err != nil {
 		return errors.Wrap(err, "failed to login to training portal")
 	}
 
-	details, err := catalogApiRequester.GetWorkshopSession(o.Name)
+	details, err := catalogApiRequester.GetWorkshopSession(cmd.Context(), o.Name)
 	if err != nil {
 		return err
 	}
@@ -52,7 +47,7 @@ func (p *ProjectInfo) NewClusterSessionStatusCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		Use:   "status NAME",
 		Short: "Output status of session in Kubernetes",
-		RunE:  func(_ *cobra.Command, args []string) error { o.Name = args[0]; return o.Run() },
+		RunE:  func(cmd *cobra.Command, args []string) error { o.Name = args[0]; return o.Run(cmd) },
 	}
 
 	c.Flags().StringVar(
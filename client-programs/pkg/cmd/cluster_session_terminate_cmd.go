@@ -5,8 +5,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
-	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
 )
 
 type ClusterSessionTerminateOptions struct {
@@ -15,22 +13,19 @@ type ClusterSessionTerminateOptions struct {
 	Name   string
 }
 
-func (o *ClusterSessionTerminateOptions) Run() error {
-	var err error
+func (o *ClusterSessionTerminateOptions) Run(cmd *cobra.Command) error {
+	catalogApiRequester, _, err := o.catalogRequester(o.Portal)
 
-	clusterConfig := cluster.NewClusterConfig(o.Kubeconfig, o.Context)
+	if err != nil {
+		return err
+	}
 
-	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
-		clusterConfig,
-		o.Portal,
-	)
-	logout, err := catalogApiRequester.Login()
-	defer logout()
+	err = catalogApiRequester.Login(cmd.Context())
 	if err != nil {
 		return errors.Wrap(err, "failed to login to training portal")
 	}
 
-	details, err := catalogApiRequester.TerminateWorkshopSession(o.Name)
+	details, err := catalogApiRequester.TerminateWorkshopSession(cmd.Context(), o.Name)
 	if err != nil {
 		return err
 	}
@@ -53,7 +48,7 @@ func (p *ProjectInfo) NewClusterSessionTerminateCmd() *cobra.Command {
 		Use:     "delete NAME",
 		Aliases: []string{"terminate"},
 		Short:   "Terminate running session in Kubernetes",
-		RunE:    func(_ *cobra.Command, args []string) error { o.Name = args[0]; return o.Run() },
+		RunE:    func(cmd *cobra.Command, args []string) error { o.Name = args[0]; return o.Run(cmd) },
 	}
 
 	c.Flags().StringVar(
@@ -24,6 +24,7 @@ func (p *ProjectInfo) NewClusterWorkshopCmdGroup() *cobra.Command {
 				p.NewClusterWorkshopListCmd(),
 				p.NewClusterWorkshopServeCmd(),
 				p.NewClusterWorkshopRequestCmd(),
+				p.NewClusterWorkshopLoadTestCmd(),
 				p.NewClusterWorkshopUpdateCmd(),
 				p.NewClusterWorkshopDeleteCmd(),
 			},
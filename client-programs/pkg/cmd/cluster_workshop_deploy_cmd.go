@@ -7,7 +7,6 @@ import (
 	"hash/maphash"
 	"io"
 	"math/rand"
-	"net/http"
 	"net/url"
 	"os/exec"
 	"runtime"
@@ -16,6 +15,7 @@ import (
 
 	yttcmd "carvel.dev/ytt/pkg/cmd/template"
 	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -611,7 +611,7 @@ func deployWorkshopResource(client dynamic.Interface, workshop *unstructured.Uns
 
 			time.Sleep(time.Second)
 
-			resp, err := http.Get(rootUrl)
+			resp, err := httpclient.Client().Get(rootUrl)
 
 			if err != nil || resp.StatusCode == 503 {
 				continue
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+	"github.com/educates/educates-training-platform/client-programs/pkg/loadtest"
+)
+
+type ClusterWorkshopLoadTestOptions struct {
+	KubeconfigOptions
+	Name              string
+	Portal            string
+	EnvironmentName   string
+	Sessions          int
+	Concurrency       int
+	RampUp            time.Duration
+	UserPrefix        string
+	Params            []string
+	IndexUrl          string
+	ActivationTimeout int
+	ReadyTimeout      time.Duration
+	PollInterval      time.Duration
+	Output            string
+	Format            string
+}
+
+func (o *ClusterWorkshopLoadTestOptions) Run(cmd *cobra.Command) error {
+	if o.Name == "" {
+		return errors.New("name of workshop to load test must be given")
+	}
+
+	if o.Format != "json" && o.Format != "csv" {
+		return errors.Errorf("invalid output format %q, must be json or csv", o.Format)
+	}
+
+	var params []educatesrestapi.Parameter
+
+	for _, item := range o.Params {
+		parts := strings.SplitN(item, "=", 2)
+
+		if len(parts) != 2 {
+			return errors.Errorf("invalid parameter format %s", item)
+		}
+
+		params = append(params, educatesrestapi.Parameter{Name: parts[0], Value: parts[1]})
+	}
+
+	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+
+	if err != nil {
+		return err
+	}
+
+	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
+		clusterConfig,
+		o.Portal,
+	)
+
+	err = catalogApiRequester.Login(cmd.Context())
+
+	if err != nil {
+		return err
+	}
+
+	// Work out the name of the workshop environment if not supplied, the
+	// same as when requesting a single workshop session.
+
+	environmentName := o.EnvironmentName
+
+	if environmentName == "" {
+		listEnvironmentsResult, err := catalogApiRequester.GetWorkshopsCatalog(cmd.Context())
+
+		if err != nil {
+			return errors.Wrap(err, "failed to get workshops catalog")
+		}
+
+		for _, item := range listEnvironmentsResult.Environments {
+			if item.Workshop.Name == o.Name && item.State == "RUNNING" {
+				environmentName = item.Name
+			}
+		}
+	}
+
+	if environmentName == "" {
+		return errors.Errorf("cannot find workshop environment for workshop %s", o.Name)
+	}
+
+	indexUrl := o.IndexUrl
+
+	if indexUrl == "" {
+		indexUrl = fmt.Sprintf("%s/accounts/logout/", catalogApiRequester.PortalUrl)
+	}
+
+	options := loadtest.Options{
+		Environment:       environmentName,
+		Sessions:          o.Sessions,
+		Concurrency:       o.Concurrency,
+		RampUp:            o.RampUp,
+		UserPrefix:        o.UserPrefix,
+		IndexURL:          indexUrl,
+		Parameters:        params,
+		ActivationTimeout: o.ActivationTimeout,
+		ReadyTimeout:      o.ReadyTimeout,
+		PollInterval:      o.PollInterval,
+	}
+
+	// Interrupting the load test stops further workshop sessions being
+	// requested, but those already allocated are still cleaned up.
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Requesting %d workshop sessions from workshop environment %q.\n", o.Sessions, environmentName)
+
+	results, err := loadtest.Run(ctx, catalogApiRequester.Client, options)
+
+	if err != nil {
+		return err
+	}
+
+	summary := loadtest.Summarize(results)
+
+	fmt.Println("Sessions:", summary.Sessions)
+	fmt.Println("Succeeded:", summary.Succeeded)
+	fmt.Println("Failed:", summary.Failed)
+	fmt.Printf("Allocation: p50=%s p95=%s p99=%s\n", summary.AllocationTimes.P50.Round(time.Millisecond), summary.AllocationTimes.P95.Round(time.Millisecond), summary.AllocationTimes.P99.Round(time.Millisecond))
+	fmt.Printf("Ready: p50=%s p95=%s p99=%s\n", summary.ReadyTimes.P50.Round(time.Millisecond), summary.ReadyTimes.P95.Round(time.Millisecond), summary.ReadyTimes.P99.Round(time.Millisecond))
+
+	for _, result := range results {
+		if result.Failed() {
+			fmt.Printf("Failure for user %q: %s\n", result.User, result.Error)
+		}
+
+		if result.CleanupError != "" {
+			fmt.Printf("Unable to terminate workshop session %q: %s\n", result.Session, result.CleanupError)
+		}
+	}
+
+	if o.Output == "" {
+		return nil
+	}
+
+	var w io.Writer = os.Stdout
+
+	if o.Output != "-" {
+		file, err := os.Create(o.Output)
+
+		if err != nil {
+			return errors.Wrapf(err, "unable to create output file %s", o.Output)
+		}
+
+		defer file.Close()
+
+		w = file
+	}
+
+	if o.Format == "csv" {
+		return loadtest.WriteCSV(w, results)
+	}
+
+	return loadtest.WriteJSON(w, results)
+}
+
+func (p *ProjectInfo) NewClusterWorkshopLoadTestCmd() *cobra.Command {
+	var o ClusterWorkshopLoadTestOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "load-test",
+		Short: "Load test workshop in Kubernetes",
+		Long: "Request a number of workshop sessions concurrently from the training " +
+			"portal on behalf of synthetic users, activating each and waiting until " +
+			"it is running, then report how long allocation and startup took. The " +
+			"workshop sessions created are terminated when the load test finishes.",
+		RunE: func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVarP(
+		&o.Name,
+		"name",
+		"n",
+		"",
+		"name of the workshop being load tested",
+	)
+	c.Flags().StringVar(
+		&o.Kubeconfig,
+		"kubeconfig",
+		"",
+		"kubeconfig file to use instead of $KUBECONFIG or $HOME/.kube/config",
+	)
+	c.Flags().StringVar(
+		&o.Context,
+		"context",
+		"",
+		"Context to use from Kubeconfig",
+	)
+	c.Flags().StringVarP(
+		&o.Portal,
+		"portal",
+		"p",
+		"educates-cli",
+		"name to be used for training portal and workshop name prefixes",
+	)
+	c.Flags().StringVar(
+		&o.EnvironmentName,
+		"environment-name",
+		"",
+		"workshop environment name, overrides derived environment name",
+	)
+	c.Flags().IntVar(
+		&o.Sessions,
+		"sessions",
+		10,
+		"number of workshop sessions to request",
+	)
+	c.Flags().IntVar(
+		&o.Concurrency,
+		"concurrency",
+		loadtest.DefaultConcurrency,
+		"maximum number of workshop sessions being requested at the same time",
+	)
+	c.Flags().DurationVar(
+		&o.RampUp,
+		"ramp-up",
+		0,
+		"time over which to spread the starts of the requests for workshop sessions",
+	)
+	c.Flags().StringVar(
+		&o.UserPrefix,
+		"user-prefix",
+		loadtest.DefaultUserPrefix,
+		"prefix for the names of the synthetic users workshop sessions are requested for",
+	)
+	c.Flags().StringArrayVarP(
+		&o.Params,
+		"param",
+		"",
+		[]string{},
+		"set request parameter data value, as string, (format name=value)",
+	)
+	c.Flags().StringVar(
+		&o.IndexUrl,
+		"index-url",
+		"",
+		"the URL to redirect to when workshop session is complete",
+	)
+	c.Flags().IntVar(
+		&o.ActivationTimeout,
+		"timeout",
+		60,
+		"maximum time in seconds to activate each workshop session",
+	)
+	c.Flags().DurationVar(
+		&o.ReadyTimeout,
+		"ready-timeout",
+		loadtest.DefaultReadyTimeout,
+		"maximum time to wait for each workshop session to be running",
+	)
+	c.Flags().DurationVar(
+		&o.PollInterval,
+		"poll-interval",
+		loadtest.DefaultPollInterval,
+		"interval between checks of whether a workshop session is running",
+	)
+	c.Flags().StringVarP(
+		&o.Output,
+		"output",
+		"o",
+		"",
+		"file to write results of each workshop session to, or - for stdout",
+	)
+	c.Flags().StringVar(
+		&o.Format,
+		"format",
+		"json",
+		"format of results written to output file, either json or csv",
+	)
+
+	return c
+}
@@ -37,7 +37,7 @@ type ClusterWorkshopRequestOptions struct {
 	DataValuesFlags   yttcmd.DataValuesFlags
 }
 
-func (o *ClusterWorkshopRequestOptions) Run() error {
+func (o *ClusterWorkshopRequestOptions) Run(cmd *cobra.Command) error {
 	var err error
 
 	var name = o.Name
@@ -116,20 +116,23 @@ func (o *ClusterWorkshopRequestOptions) Run() error {
 		name = workshop.GetName()
 	}
 
-	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+	catalogApiRequester, clusterConfig, err := o.catalogRequester(o.Portal)
 
 	if err != nil {
 		return err
 	}
 
-	// check that the portal has the workshop we want to request
-	err = ensurePortalHasWorkshop(clusterConfig, name, o.Portal)
-	if err != nil {
-		return err
+	// check that the portal has the workshop we want to request, which can
+	// only be done where the training portal is in the cluster
+	if clusterConfig != nil {
+		err = ensurePortalHasWorkshop(clusterConfig, name, o.Portal)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Request the workshop from the training portal.
-	err = requestWorkshop(clusterConfig, name, o.EnvironmentName, o.Portal, params, o.IndexUrl, o.UserIdentity, o.ActivationTimeout, o.NoBrowser)
+	err = requestWorkshop(cmd.Context(), catalogApiRequester, name, o.EnvironmentName, params, o.IndexUrl, o.UserIdentity, o.ActivationTimeout, o.NoBrowser)
 
 	if err != nil {
 		return err
@@ -145,7 +148,7 @@ func (p *ProjectInfo) NewClusterWorkshopRequestCmd() *cobra.Command {
 		Args:  cobra.NoArgs,
 		Use:   "request",
 		Short: "Request workshop in Kubernetes",
-		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		RunE:  func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
 	}
 
 	c.Flags().StringVarP(
@@ -329,19 +332,14 @@ func ensurePortalHasWorkshop(clusterConfig *cluster.ClusterConfig, name string,
 	return nil
 }
 
-func requestWorkshop(clusterConfig *cluster.ClusterConfig, workshopName string, environmentName string, portalName string, params map[string]string, indexUrl string, user string, timeout int, noBrowser bool) error {
-	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(
-		clusterConfig,
-		portalName,
-	)
-	logout, err := catalogApiRequester.Login()
+func requestWorkshop(ctx context.Context, catalogApiRequester *educatesrestapi.WorkshopsCatalogRequester, workshopName string, environmentName string, params map[string]string, indexUrl string, user string, timeout int, noBrowser bool) error {
+	err := catalogApiRequester.Login(ctx)
 	if err != nil {
 		return err
 	}
-	defer logout()
 
 	// Get the list of workshops so we can know which workshop environment
-	listEnvironmentsResult, err := catalogApiRequester.GetWorkshopsCatalog()
+	listEnvironmentsResult, err := catalogApiRequester.GetWorkshopsCatalog(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to get workshops catalog")
 	}
@@ -360,7 +358,7 @@ func requestWorkshop(clusterConfig *cluster.ClusterConfig, workshopName string,
 	}
 
 	// Now request the workshop from the required workshop environment.
-	requestWorkshopResult, err := catalogApiRequester.RequestWorkshop(workshopName, environmentName, params, indexUrl, user, timeout)
+	requestWorkshopResult, err := catalogApiRequester.RequestWorkshop(ctx, workshopName, environmentName, params, indexUrl, user, timeout)
 	if err != nil {
 		return err
 	}
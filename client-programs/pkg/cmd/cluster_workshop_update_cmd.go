@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -233,9 +234,7 @@ func loadWorkshopDefinition(name string, path string, portal string, workshopFil
 			return nil, errors.Wrap(err, "couldn't read workshop definition data file")
 		}
 	} else {
-		var client http.Client
-
-		resp, err := client.Get(path)
+		resp, err := httpclient.Client().Get(path)
 
 		if err != nil {
 			return nil, errors.Wrap(err, "couldn't download workshop definition from host")
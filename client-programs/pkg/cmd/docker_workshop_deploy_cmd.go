@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -19,6 +18,7 @@ import (
 	composeloader "github.com/compose-spec/compose-go/loader"
 	composetypes "github.com/compose-spec/compose-go/types"
 	"github.com/docker/docker/client"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 	"github.com/educates/educates-training-platform/client-programs/pkg/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -421,7 +421,7 @@ func (o *DockerWorkshopDeployOptions) Run(cmd *cobra.Command) error {
 		for i := 1; i < 300; i++ {
 			time.Sleep(time.Second)
 
-			resp, err := http.Get(url)
+			resp, err := httpclient.Client().Get(url)
 
 			if err != nil {
 				continue
@@ -4,13 +4,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os/exec"
 	"runtime"
 	"time"
 
 	yttcmd "carvel.dev/ytt/pkg/cmd/template"
 	"github.com/docker/docker/client"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -81,7 +81,7 @@ func (o *DockerWorkshopOpenOptions) Run() error {
 	for i := 1; i < 120; i++ {
 		time.Sleep(time.Second)
 
-		resp, err := http.Get(url)
+		resp, err := httpclient.Client().Get(url)
 
 		if err != nil {
 			continue
@@ -5,6 +5,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"k8s.io/kubectl/pkg/util/templates"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 )
 
 /*
@@ -16,6 +18,29 @@ func (p *ProjectInfo) NewEducatesCmdGroup() *cobra.Command {
 		Short: "Tools for managing Educates",
 	}
 
+	// Options for network connections apply to all commands, so they are
+	// defined as global flags, with the shared HTTP client configured from
+	// them before any command is run.
+
+	var httpOptions httpclient.Options
+
+	c.PersistentFlags().StringArrayVar(
+		&httpOptions.CAFiles,
+		"ca-file",
+		[]string{},
+		"file of PEM encoded certificate authorities to trust for network connections (can be repeated)",
+	)
+	c.PersistentFlags().BoolVar(
+		&httpOptions.InsecureSkipTLSVerify,
+		"insecure-skip-tls-verify",
+		false,
+		"don't verify server certificates for network connections, making them insecure",
+	)
+
+	c.PersistentPreRunE = func(_ *cobra.Command, _ []string) error {
+		return httpclient.Configure(httpOptions)
+	}
+
 	// Use a command group as it allows us to dictate the order in which they
 	// are displayed in the help message, as otherwise they are displayed in
 	// sort order.
@@ -76,6 +101,7 @@ func (p *ProjectInfo) NewEducatesCmdGroup() *cobra.Command {
 				p.NewClusterCmdGroup(),
 				p.NewDockerCmdGroup(),
 				p.NewTunnelCmdGroup(),
+				p.NewLookupCmdGroup(),
 			},
 		},
 	}
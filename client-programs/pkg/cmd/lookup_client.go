@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/lookupservice"
+)
+
+// LookupClientOptions holds the options common to commands which make calls
+// against the lookup service using the access token saved when logging in.
+type LookupClientOptions struct {
+	Url    string
+	Output string
+}
+
+func (o *LookupClientOptions) addFlags(c *cobra.Command) {
+	c.Flags().StringVar(
+		&o.Url,
+		"url",
+		"",
+		"URL of lookup service, if not the one last logged into",
+	)
+	c.Flags().StringVarP(
+		&o.Output,
+		"output",
+		"o",
+		"table",
+		"output format, either table or json",
+	)
+}
+
+// client returns a client for the lookup service using the saved access
+// token, after checking the output format is valid.
+func (o *LookupClientOptions) client() (*lookupservice.Client, error) {
+	if o.Output != "table" && o.Output != "json" {
+		return nil, errors.Errorf("invalid output format %q, must be table or json", o.Output)
+	}
+
+	client, err := lookupservice.NewClientFromCachedToken(o.Url)
+
+	if errors.Is(err, lookupservice.ErrLoginRequired) {
+		return nil, errors.Wrap(err, "use \"educates lookup login\" to login")
+	}
+
+	return client, err
+}
+
+// printJSON prints a value as JSON, for when the output format is json.
+func printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal output")
+	}
+
+	fmt.Fprintln(os.Stdout, string(data))
+
+	return nil
+}
+
+// formatLabels formats labels for output in a table, sorted by name.
+func formatLabels(labels map[string]string) string {
+	var items []string
+
+	for name, value := range labels {
+		items = append(items, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	sort.Strings(items)
+
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type LookupClustersListOptions struct {
+	LookupClientOptions
+}
+
+func (o *LookupClustersListOptions) Run() error {
+	client, err := o.client()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	clusters, err := client.ListClusters(ctx)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list clusters")
+	}
+
+	if o.Output == "json" {
+		return printJSON(clusters)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 8, 8, 3, ' ', 0)
+
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\n", "NAME", "LABELS")
+
+	for _, item := range clusters {
+		fmt.Fprintf(w, "%s\t%s\n", item.Name, formatLabels(item.Labels))
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewLookupClustersListCmd() *cobra.Command {
+	var o LookupClustersListOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "list",
+		Short: "List clusters known to lookup service",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	o.addFlags(c)
+
+	return c
+}
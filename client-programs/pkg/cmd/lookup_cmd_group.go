@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"k8s.io/kubectl/pkg/util/templates"
+)
+
+func (p *ProjectInfo) NewLookupCmdGroup() *cobra.Command {
+	var c = &cobra.Command{
+		Use:   "lookup",
+		Short: "Access Educates lookup service",
+	}
+
+	// Use a command group as it allows us to dictate the order in which they
+	// are displayed in the help message, as otherwise they are displayed in
+	// sort order.
+
+	commandGroups := templates.CommandGroups{
+		{
+			Message: "Available Commands:",
+			Commands: []*cobra.Command{
+				p.NewLookupLoginCmd(),
+				p.NewLookupLogoutCmd(),
+			},
+		},
+		{
+			Message: "Command Groups:",
+			Commands: []*cobra.Command{
+				p.NewLookupTenantsCmdGroup(),
+				p.NewLookupClustersCmdGroup(),
+				p.NewLookupPortalsCmdGroup(),
+				p.NewLookupWorkshopsCmdGroup(),
+			},
+		},
+	}
+
+	commandGroups.Add(c)
+
+	templates.ActsAsRootCommand(c, []string{"--help"}, commandGroups...)
+
+	return c
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/lookupservice"
+)
+
+type LookupLoginOptions struct {
+	Url           string
+	Username      string
+	Password      string
+	PasswordStdin bool
+}
+
+func (o *LookupLoginOptions) Run() error {
+	serviceUrl := o.Url
+
+	if serviceUrl == "" {
+		serviceUrl = os.Getenv("EDUCATES_LOOKUP_URL")
+	}
+
+	if serviceUrl == "" {
+		return errors.New("URL of lookup service must be given")
+	}
+
+	username := o.Username
+
+	if username == "" {
+		username = os.Getenv("EDUCATES_LOOKUP_USERNAME")
+	}
+
+	if username == "" {
+		return errors.New("username for lookup service must be given")
+	}
+
+	password := o.Password
+
+	if o.PasswordStdin {
+		if password != "" {
+			return errors.New("--password and --password-stdin are mutually exclusive")
+		}
+
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+		if err != nil && line == "" {
+			return errors.Wrap(err, "unable to read password from stdin")
+		}
+
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		password = os.Getenv("EDUCATES_LOOKUP_PASSWORD")
+	}
+
+	if password == "" {
+		return errors.New("password for lookup service must be given")
+	}
+
+	client := lookupservice.NewClient(serviceUrl, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	response, err := client.Login(ctx, username, password)
+
+	if err != nil {
+		return errors.Wrap(err, "failed to login to lookup service")
+	}
+
+	token := &lookupservice.CachedToken{
+		URL:         client.URL,
+		Username:    username,
+		AccessToken: response.AccessToken,
+		Expires:     time.Unix(response.ExpiresAt, 0),
+	}
+
+	if err := lookupservice.WriteCachedToken(token); err != nil {
+		return err
+	}
+
+	fmt.Println("Service:", token.URL)
+	fmt.Println("Expires:", token.Expires.Local().Format(time.RFC3339))
+
+	return nil
+}
+
+func (p *ProjectInfo) NewLookupLoginCmd() *cobra.Command {
+	var o LookupLoginOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "login",
+		Short: "Login to lookup service",
+		Long: "Login to the lookup service with the credentials of a client of the " +
+			"lookup service, saving the access token so it can be used by later " +
+			"commands. The access token cannot be refreshed, so when it expires you " +
+			"will need to login again.",
+		RunE: func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	c.Flags().StringVar(
+		&o.Url,
+		"url",
+		"",
+		"URL of lookup service, defaults to $EDUCATES_LOOKUP_URL",
+	)
+	c.Flags().StringVar(
+		&o.Username,
+		"username",
+		"",
+		"username of lookup service client, defaults to $EDUCATES_LOOKUP_USERNAME",
+	)
+	c.Flags().StringVar(
+		&o.Password,
+		"password",
+		"",
+		"password of lookup service client, defaults to $EDUCATES_LOOKUP_PASSWORD",
+	)
+	c.Flags().BoolVar(
+		&o.PasswordStdin,
+		"password-stdin",
+		false,
+		"read password of lookup service client from stdin",
+	)
+
+	return c
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/lookupservice"
+)
+
+type LookupLogoutOptions struct{}
+
+func (o *LookupLogoutOptions) Run() error {
+	client, err := lookupservice.NewClientFromCachedToken("")
+
+	// Where the saved access token has already expired there is nothing to
+	// revoke, but the file holding it should still be removed.
+
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err = client.Logout(ctx)
+
+		if err != nil && !errors.Is(err, lookupservice.ErrUnauthorized) {
+			return errors.Wrap(err, "failed to logout from lookup service")
+		}
+	} else if !errors.Is(err, lookupservice.ErrLoginRequired) {
+		return err
+	}
+
+	return lookupservice.RemoveCachedToken()
+}
+
+func (p *ProjectInfo) NewLookupLogoutCmd() *cobra.Command {
+	var o LookupLogoutOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "logout",
+		Short: "Logout from lookup service",
+		Long: "Revoke the access tokens issued to the client of the lookup service " +
+			"and remove the saved access token from disk.",
+		RunE: func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	return c
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/lookupservice"
+)
+
+type LookupPortalsListOptions struct {
+	LookupClientOptions
+	Cluster string
+	Tenant  string
+}
+
+func (o *LookupPortalsListOptions) Run() error {
+	if o.Cluster != "" && o.Tenant != "" {
+		return errors.New("--cluster and --tenant are mutually exclusive")
+	}
+
+	client, err := o.client()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var portals []lookupservice.Portal
+
+	switch {
+	case o.Cluster != "":
+		portals, err = client.ListClusterPortals(ctx, o.Cluster)
+	case o.Tenant != "":
+		portals, err = client.ListTenantPortals(ctx, o.Tenant)
+	default:
+		portals, err = client.ListPortals(ctx)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list training portals")
+	}
+
+	if o.Output == "json" {
+		return printJSON(portals)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 8, 8, 3, ' ', 0)
+
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "NAME", "CLUSTER", "CAPACITY", "ALLOCATED", "PHASE", "URL")
+
+	for _, item := range portals {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", item.Name, item.Cluster, item.Capacity, item.Allocated, item.Phase, item.URL)
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewLookupPortalsListCmd() *cobra.Command {
+	var o LookupPortalsListOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "list",
+		Short: "List training portals known to lookup service",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	o.addFlags(c)
+
+	c.Flags().StringVar(
+		&o.Cluster,
+		"cluster",
+		"",
+		"only list training portals of this cluster",
+	)
+	c.Flags().StringVar(
+		&o.Tenant,
+		"tenant",
+		"",
+		"only list training portals accessible to this tenant",
+	)
+
+	return c
+}
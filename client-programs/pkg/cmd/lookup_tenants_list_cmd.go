@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type LookupTenantsListOptions struct {
+	LookupClientOptions
+}
+
+func (o *LookupTenantsListOptions) Run() error {
+	client, err := o.client()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tenants, err := client.ListTenants(ctx)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list tenants")
+	}
+
+	if o.Output == "json" {
+		return printJSON(tenants)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 8, 8, 3, ' ', 0)
+
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\n", "NAME", "CLIENTS")
+
+	for _, item := range tenants {
+		fmt.Fprintf(w, "%s\t%s\n", item.Name, strings.Join(item.Clients, ","))
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewLookupTenantsListCmd() *cobra.Command {
+	var o LookupTenantsListOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "list",
+		Short: "List tenants of lookup service",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	o.addFlags(c)
+
+	return c
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type LookupWorkshopsListOptions struct {
+	LookupClientOptions
+	Tenant  string
+	Cluster string
+	Portal  string
+}
+
+func (o *LookupWorkshopsListOptions) Run() error {
+	if (o.Cluster == "") != (o.Portal == "") {
+		return errors.New("--cluster and --portal must be given together")
+	}
+
+	if o.Cluster != "" && o.Tenant != "" {
+		return errors.New("--tenant cannot be given with --cluster and --portal")
+	}
+
+	client, err := o.client()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 8, 8, 3, ' ', 0)
+
+	defer w.Flush()
+
+	// When a training portal is given, list the workshop environments of the
+	// training portal so the capacity for each workshop can be shown.
+
+	if o.Cluster != "" {
+		environments, err := client.ListEnvironments(ctx, o.Cluster, o.Portal)
+
+		if err != nil {
+			return errors.Wrap(err, "unable to list workshop environments")
+		}
+
+		if o.Output == "json" {
+			return printJSON(environments)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "NAME", "ENVIRONMENT", "CAPACITY", "ALLOCATED", "AVAILABLE", "PHASE")
+
+		for _, item := range environments {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", item.Workshop, item.Name, item.Capacity, item.Allocated, item.Available, item.Phase)
+		}
+
+		return nil
+	}
+
+	workshops, err := client.ListWorkshops(ctx, o.Tenant)
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list workshops")
+	}
+
+	if o.Output == "json" {
+		return printJSON(workshops)
+	}
+
+	fmt.Fprintf(w, "%s\t%s\n", "NAME", "TITLE")
+
+	for _, item := range workshops {
+		fmt.Fprintf(w, "%s\t%s\n", item.Name, item.Title)
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewLookupWorkshopsListCmd() *cobra.Command {
+	var o LookupWorkshopsListOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "list",
+		Short: "List workshops available through lookup service",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	o.addFlags(c)
+
+	c.Flags().StringVar(
+		&o.Tenant,
+		"tenant",
+		"",
+		"only list workshops available to this tenant",
+	)
+	c.Flags().StringVar(
+		&o.Cluster,
+		"cluster",
+		"",
+		"cluster of training portal to list workshop environments for",
+	)
+	c.Flags().StringVar(
+		&o.Portal,
+		"portal",
+		"",
+		"training portal to list workshop environments for",
+	)
+
+	return c
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/lookupservice"
+)
+
+type LookupWorkshopsRequestOptions struct {
+	LookupClientOptions
+	Tenant    string
+	Workshop  string
+	User      string
+	Email     string
+	FirstName string
+	LastName  string
+	IndexUrl  string
+	Params    []string
+}
+
+func (o *LookupWorkshopsRequestOptions) Run() error {
+	request := &lookupservice.WorkshopRequest{
+		TenantName:       o.Tenant,
+		WorkshopName:     o.Workshop,
+		ClientUserId:     o.User,
+		UserEmailAddress: o.Email,
+		UserFirstName:    o.FirstName,
+		UserLastName:     o.LastName,
+		ClientIndexUrl:   o.IndexUrl,
+	}
+
+	for _, param := range o.Params {
+		name, value, found := strings.Cut(param, "=")
+
+		if !found || name == "" {
+			return errors.Errorf("invalid workshop parameter %q, must be name=value", param)
+		}
+
+		request.WorkshopParams = append(request.WorkshopParams, lookupservice.Parameter{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	client, err := o.client()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	session, err := client.RequestWorkshop(ctx, request)
+
+	if errors.Is(err, lookupservice.ErrUnavailable) {
+		return errors.Wrapf(err, "no capacity available for workshop %q", o.Workshop)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to request workshop")
+	}
+
+	if o.Output == "json" {
+		return printJSON(session)
+	}
+
+	fmt.Println("Session:", session.SessionName)
+	fmt.Println("Cluster:", session.ClusterName)
+	fmt.Println("Portal:", session.PortalName)
+	fmt.Println("Environment:", session.EnvironmentName)
+	fmt.Println("URL:", session.SessionActivationUrl)
+
+	return nil
+}
+
+func (p *ProjectInfo) NewLookupWorkshopsRequestCmd() *cobra.Command {
+	var o LookupWorkshopsRequestOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "request",
+		Short: "Request workshop session through lookup service",
+		Long: "Request a workshop session for a tenant from whichever training portal " +
+			"hosting the workshop has capacity. The workshop session is activated " +
+			"by visiting the returned URL.",
+		RunE: func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+
+	o.addFlags(c)
+
+	c.Flags().StringVar(
+		&o.Tenant,
+		"tenant",
+		"",
+		"name of the tenant to request workshop for",
+	)
+	c.Flags().StringVar(
+		&o.Workshop,
+		"workshop",
+		"",
+		"name of the workshop to request session for",
+	)
+	c.Flags().StringVar(
+		&o.User,
+		"user",
+		"",
+		"client user ID, returning existing session for the same user",
+	)
+	c.Flags().StringVar(
+		&o.Email,
+		"email",
+		"",
+		"email address of user",
+	)
+	c.Flags().StringVar(
+		&o.FirstName,
+		"first-name",
+		"",
+		"first name of user",
+	)
+	c.Flags().StringVar(
+		&o.LastName,
+		"last-name",
+		"",
+		"last name of user",
+	)
+	c.Flags().StringVar(
+		&o.IndexUrl,
+		"index-url",
+		"",
+		"URL to redirect to when workshop session is finished",
+	)
+	c.Flags().StringArrayVar(
+		&o.Params,
+		"param",
+		[]string{},
+		"workshop parameter as name=value, can be given more than once",
+	)
+
+	cobra.MarkFlagRequired(c.Flags(), "tenant")
+	cobra.MarkFlagRequired(c.Flags(), "workshop")
+
+	return c
+}
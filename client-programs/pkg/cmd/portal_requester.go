@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+// catalogRequester returns a requester for the REST API of the training
+// portal. Where the URL and credentials of the training portal are given by
+// the EDUCATES_PORTAL_* environment variables, the cluster is not accessed,
+// so that commands can be run against a training portal outside of the
+// cluster, such as a fake training portal when testing. The cluster config
+// returned is nil in that case.
+func (o *KubeconfigOptions) catalogRequester(portal string) (*educatesrestapi.WorkshopsCatalogRequester, *cluster.ClusterConfig, error) {
+	if access := educatesrestapi.PortalAccessFromEnv(); access != nil {
+		return educatesrestapi.NewWorkshopsCatalogRequesterForPortal(portal, access), nil, nil
+	}
+
+	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return educatesrestapi.NewWorkshopsCatalogRequester(clusterConfig, portal), clusterConfig, nil
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
+	"github.com/educates/educates-training-platform/tunnel-manager/pkg/tunnel"
+)
+
+// TunnelAuthOptions holds the options common to commands which connect to
+// the tunnel for a workshop session, for working out the URL of the tunnel
+// and authenticating with it.
+type TunnelAuthOptions struct {
+	KubeconfigOptions
+	Url     string
+	Portal  string
+	Session string
+	Token   string
+	Cookies []string
+}
+
+func (o *TunnelAuthOptions) addFlags(c *cobra.Command) {
+	c.Flags().StringVar(
+		&o.Url,
+		"url",
+		"",
+		"URL of websocket for connecting to workshop session",
+	)
+	c.Flags().StringVar(
+		&o.Kubeconfig,
+		"kubeconfig",
+		"",
+		"kubeconfig file to use instead of $KUBECONFIG or $HOME/.kube/config",
+	)
+	c.Flags().StringVar(
+		&o.Context,
+		"context",
+		"",
+		"Context to use from Kubeconfig",
+	)
+	c.Flags().StringVarP(
+		&o.Portal,
+		"portal",
+		"p",
+		"",
+		"name of the training portal the workshop session belongs to",
+	)
+	c.Flags().StringVarP(
+		&o.Session,
+		"session",
+		"s",
+		"",
+		"name of the workshop session to connect to",
+	)
+	c.Flags().StringVar(
+		&o.Token,
+		"token",
+		"",
+		"bearer token to authenticate with instead of the credentials of the workshop session",
+	)
+	c.Flags().StringArrayVar(
+		&o.Cookies,
+		"cookie",
+		[]string{},
+		"cookie to send when connecting, as name=value (can be repeated)",
+	)
+
+	c.MarkFlagsRequiredTogether("portal", "session")
+	c.MarkFlagsOneRequired("url", "session")
+}
+
+// configureDialer sets the URL of the tunnel and how to authenticate with it
+// for the dialer. When a training portal and workshop session are given, the
+// URL of the tunnel is looked up from the workshop session, and if no token
+// was supplied, the config password of the workshop session is obtained from
+// the training portal to use as the token. As that token is only sent to the
+// tunnel of the workshop session it was issued for, a URL cannot be supplied
+// in that case.
+func (o *TunnelAuthOptions) configureDialer(dialer *tunnel.Dialer) error {
+	dialer.URL = o.Url
+	dialer.WebsocketDialer = httpclient.NewWebsocketDialer()
+
+	for _, cookie := range o.Cookies {
+		name, value, found := strings.Cut(cookie, "=")
+
+		if !found || name == "" {
+			return errors.Errorf("invalid cookie %q, must be name=value", cookie)
+		}
+
+		dialer.Cookies = append(dialer.Cookies, &http.Cookie{Name: name, Value: value})
+	}
+
+	if o.Token != "" {
+		dialer.Token = func(context.Context, bool) (string, error) {
+			return o.Token, nil
+		}
+	}
+
+	if o.Session == "" {
+		return nil
+	}
+
+	if o.Url != "" && o.Token == "" {
+		return errors.New("--url cannot be used with --session unless --token is also given")
+	}
+
+	// Nothing needs to be looked up if both the URL and the token were given,
+	// so the cluster does not need to be accessible in that case.
+
+	if o.Url != "" && o.Token != "" {
+		return nil
+	}
+
+	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+
+	if err != nil {
+		return err
+	}
+
+	if dialer.URL == "" {
+		details, err := lookupWorkshopSessionTunnel(clusterConfig, o.Portal, o.Session)
+
+		if err != nil {
+			return err
+		}
+
+		dialer.URL = details.Url
+	}
+
+	if dialer.Token == nil {
+		dialer.Token = o.sessionTokenSource(clusterConfig)
+	}
+
+	return nil
+}
+
+// workshopSessionTunnel holds the details of a workshop session needed to
+// access it over the SSH tunnel.
+type workshopSessionTunnel struct {
+	Url         string
+	Hostname    string
+	User        string
+	Environment string
+	Namespace   string
+}
+
+// lookupWorkshopSessionTunnel returns the details of the workshop session for
+// accessing it over the SSH tunnel, checking that the session belongs to the
+// training portal and has the tunnel enabled.
+func lookupWorkshopSessionTunnel(clusterConfig *cluster.ClusterConfig, portal string, session string) (*workshopSessionTunnel, error) {
+	dynamicClient, err := clusterConfig.GetDynamicClient()
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create Kubernetes client")
+	}
+
+	workshopSessionClient := dynamicClient.Resource(workshopSessionResource)
+
+	workshopSession, err := workshopSessionClient.Get(context.TODO(), session, metav1.GetOptions{})
+
+	if k8serrors.IsNotFound(err) {
+		return nil, errors.Errorf("workshop session %q not found", session)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch workshop session %q", session)
+	}
+
+	if workshopSession.GetLabels()["training.educates.dev/portal.name"] != portal {
+		return nil, errors.Errorf("workshop session %q does not belong to training portal %q", session, portal)
+	}
+
+	enabled, _, _ := unstructured.NestedBool(workshopSession.Object, "status", "educates", "sshd", "tunnel", "enabled")
+
+	if !enabled {
+		return nil, errors.Errorf("workshop session %q does not have SSH tunnelling enabled", session)
+	}
+
+	details := &workshopSessionTunnel{}
+
+	details.Environment, _, _ = unstructured.NestedString(workshopSession.Object, "spec", "environment", "name")
+
+	sessionId, _, _ := unstructured.NestedString(workshopSession.Object, "spec", "session", "id")
+
+	details.Namespace = details.Environment + "-" + sessionId
+
+	// The workshop container always runs as the same user, whose home
+	// directory is where the workshop files are placed.
+
+	details.User = "eduk8s"
+
+	sessionUrl, _, _ := unstructured.NestedString(workshopSession.Object, "status", "educates", "url")
+
+	switch {
+	case strings.HasPrefix(sessionUrl, "https://"):
+		details.Hostname = strings.TrimPrefix(sessionUrl, "https://")
+		details.Url = "wss://" + details.Hostname + "/tunnel/"
+	case strings.HasPrefix(sessionUrl, "http://"):
+		details.Hostname = strings.TrimPrefix(sessionUrl, "http://")
+		details.Url = "ws://" + details.Hostname + "/tunnel/"
+	default:
+		return nil, errors.Errorf("workshop session %q does not have a URL yet", session)
+	}
+
+	return details, nil
+}
+
+// sessionTokenSource returns a function for getting the token for the tunnel,
+// being the config password of the workshop session. It is obtained using the
+// REST API of the training portal, but unlike the access token for the REST
+// API, which grants full access to the training portal, it is only good for
+// the one workshop session. The password is only fetched again when asked
+// for, such as when the tunnel server rejects it. Connections may be made
+// concurrently when forwarding a port, so fetching it is serialized.
+func (o *TunnelAuthOptions) sessionTokenSource(clusterConfig *cluster.ClusterConfig) func(context.Context, bool) (string, error) {
+	catalogApiRequester := educatesrestapi.NewWorkshopsCatalogRequester(clusterConfig, o.Portal)
+
+	var mutex sync.Mutex
+	var password string
+
+	return func(ctx context.Context, renew bool) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if password != "" && !renew {
+			return password, nil
+		}
+
+		// Logging in looks up the URL of the training portal, which is
+		// needed before a client for the REST API can be created.
+
+		if _, err := catalogApiRequester.Token(ctx, false); err != nil {
+			return "", errors.Wrapf(err, "unable to login to training portal %q", o.Portal)
+		}
+
+		config, err := catalogApiRequester.Client().GetSessionConfig(ctx, o.Session)
+
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to get credentials for workshop session %q", o.Session)
+		}
+
+		password = config.Password
+
+		return password, nil
+	}
+}
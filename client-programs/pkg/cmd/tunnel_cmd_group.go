@@ -20,6 +20,10 @@ func (p *ProjectInfo) NewTunnelCmdGroup() *cobra.Command {
 			Message: "Available Commands:",
 			Commands: []*cobra.Command{
 				p.NewTunnelConnectCmd(),
+				p.NewTunnelForwardCmd(),
+				p.NewTunnelSocksCmd(),
+				p.NewTunnelServeCmd(),
+				p.NewTunnelSSHConfigCmd(),
 			},
 		},
 	}
@@ -1,58 +1,51 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/tunnel-manager/pkg/tunnel"
 )
 
 type TunnelConnectOptions struct {
-	Url string
-}
-
-type session struct {
-	ws      *websocket.Conn
-	errChan chan error
+	TunnelAuthOptions
+	PingInterval time.Duration
+	IdleTimeout  time.Duration
+	Retries      int
 }
 
 func (o *TunnelConnectOptions) Run(cmd *cobra.Command) error {
-	dest, err := url.Parse(o.Url)
-
-	if err != nil {
-		return errors.Wrap(err, "unable to parse websocket URL")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dialer := &tunnel.Dialer{
+		PingInterval: o.PingInterval,
+		IdleTimeout:  o.IdleTimeout,
+		Retries:      o.Retries,
+		MaxBackoff:   10 * time.Second,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		},
 	}
 
-	originURL := *dest
-
-	origin := originURL.String()
-
-	headers := make(http.Header)
-	headers.Add("Origin", origin)
-
-	dialer := websocket.Dialer{}
+	if err := o.configureDialer(dialer); err != nil {
+		return err
+	}
 
-	ws, _, err := dialer.Dial(origin, headers)
+	conn, err := dialer.Dial(ctx)
 
 	if err != nil {
 		return errors.Wrap(err, "unable to connect to websocket URL")
 	}
 
-	sess := &session{
-		ws:      ws,
-		errChan: make(chan error),
-	}
-
-	go sess.readInput()
-	go sess.readRemote()
-
-	os.Stderr.WriteString(fmt.Sprintf("%s\n", <-sess.errChan))
-
-	return nil
+	return tunnel.Pipe(ctx, conn, os.Stdin, os.Stdout)
 }
 
 func (p *ProjectInfo) NewTunnelConnectCmd() *cobra.Command {
@@ -65,57 +58,26 @@ func (p *ProjectInfo) NewTunnelConnectCmd() *cobra.Command {
 		RunE:  func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
 	}
 
-	c.Flags().StringVar(
-		&o.Url,
-		"url",
-		"",
-		"URL of websocket for connecting to workshop session",
-	)
+	o.addFlags(c)
 
-	c.MarkFlagRequired("url")
+	c.Flags().DurationVar(
+		&o.PingInterval,
+		"ping-interval",
+		tunnel.DefaultPingInterval,
+		"interval between keepalive pings sent to the tunnel server",
+	)
+	c.Flags().DurationVar(
+		&o.IdleTimeout,
+		"idle-timeout",
+		0,
+		"close the tunnel when no data has been sent or received for this long",
+	)
+	c.Flags().IntVar(
+		&o.Retries,
+		"retries",
+		5,
+		"number of times to retry connecting to the tunnel server",
+	)
 
 	return c
 }
-
-func (s *session) readInput() {
-	in := os.Stdin
-
-	const BUF_SIZE = 16384
-	bufOut := make([]byte, BUF_SIZE)
-
-	for {
-		var n int
-		var err error
-
-		if n, err = in.Read(bufOut); err != nil || n == 0 {
-			break
-		}
-
-		if err = s.ws.WriteMessage(websocket.BinaryMessage, bufOut[0:n]); err != nil {
-			break
-		}
-	}
-}
-
-func (s *session) readRemote() {
-	out := os.Stdout
-
-	for {
-		msgType, buf, err := s.ws.ReadMessage()
-
-		if err != nil {
-			s.errChan <- err
-			return
-		}
-
-		switch msgType {
-		case websocket.BinaryMessage:
-			if _, err = out.Write(buf); err != nil {
-				return
-			}
-		default:
-			s.errChan <- fmt.Errorf("unexpected websocket frame type: %d", msgType)
-			return
-		}
-	}
-}
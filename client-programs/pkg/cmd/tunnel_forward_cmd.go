@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/tunnel-manager/pkg/tunnel"
+)
+
+type TunnelForwardOptions struct {
+	TunnelAuthOptions
+	Listen       string
+	Forwards     []string
+	Multiplex    bool
+	PingInterval time.Duration
+	IdleTimeout  time.Duration
+	Retries      int
+}
+
+// tunnelForward is a local address to accept connections on, and the target
+// to relay them to, as reached from the tunnel server. An empty target is the
+// default target of the tunnel server, being the SSH daemon.
+type tunnelForward struct {
+	listen string
+	target string
+}
+
+// parseTunnelForward parses a forward given as "[address:]port=host:port",
+// with the local address defaulting to the loopback interface.
+func parseTunnelForward(value string) (tunnelForward, error) {
+	listen, target, found := strings.Cut(value, "=")
+
+	if !found || listen == "" || target == "" {
+		return tunnelForward{}, errors.Errorf("invalid forward %q, must be [address:]port=host:port", value)
+	}
+
+	if !strings.Contains(listen, ":") {
+		listen = "127.0.0.1:" + listen
+	}
+
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		return tunnelForward{}, errors.Errorf("invalid target %q in forward %q, must be host:port", target, value)
+	}
+
+	return tunnelForward{listen: listen, target: target}, nil
+}
+
+func (o *TunnelForwardOptions) Run(cmd *cobra.Command) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The default listener for the SSH daemon is only used if no other
+	// forwards were given, or if it was explicitly set.
+
+	var forwards []tunnelForward
+
+	if len(o.Forwards) == 0 || cmd.Flags().Changed("listen") {
+		forwards = append(forwards, tunnelForward{listen: o.Listen})
+	}
+
+	for _, value := range o.Forwards {
+		forward, err := parseTunnelForward(value)
+
+		if err != nil {
+			return err
+		}
+
+		forwards = append(forwards, forward)
+	}
+
+	dialer := &tunnel.Dialer{
+		PingInterval: o.PingInterval,
+		IdleTimeout:  o.IdleTimeout,
+		Retries:      o.Retries,
+		MaxBackoff:   10 * time.Second,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(cmd.ErrOrStderr(), format+"\n", args...)
+		},
+	}
+
+	if err := o.configureDialer(dialer); err != nil {
+		return err
+	}
+
+	// Connections for all the forwards share the one session, so that when
+	// the tunnel server supports multiplexing, they all use the one websocket
+	// connection.
+
+	session := tunnel.NewSession(dialer, o.Multiplex)
+
+	defer session.Close()
+
+	var listeners []net.Listener
+
+	for _, forward := range forwards {
+		listener, err := net.Listen("tcp", forward.listen)
+
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return errors.Wrapf(err, "unable to listen on %s", forward.listen)
+		}
+
+		listeners = append(listeners, listener)
+
+		if forward.target == "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Forwarding connections on %s to %s\n", listener.Addr(), dialer.URL)
+		} else {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Forwarding connections on %s to %s via %s\n", listener.Addr(), forward.target, dialer.URL)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(forwards))
+
+	for i, forward := range forwards {
+		listener := listeners[i]
+		target := forward.target
+
+		go func() {
+			err := tunnel.ForwardSession(ctx, listener, session, target)
+
+			// Stop forwarding for all of them if any one fails.
+			cancel()
+
+			errs <- err
+		}()
+	}
+
+	var err error
+
+	for range forwards {
+		if forwardErr := <-errs; forwardErr != nil && err == nil {
+			err = forwardErr
+		}
+	}
+
+	return err
+}
+
+func (p *ProjectInfo) NewTunnelForwardCmd() *cobra.Command {
+	var o TunnelForwardOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "forward",
+		Short: "Forward a local port over websockets to a workshop session",
+		RunE:  func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	o.addFlags(c)
+
+	c.Flags().StringVar(
+		&o.Listen,
+		"listen",
+		"127.0.0.1:2222",
+		"local address and port to accept connections on for SSH",
+	)
+	c.Flags().StringArrayVar(
+		&o.Forwards,
+		"forward",
+		[]string{},
+		"additional port to forward, as [address:]port=host:port, with host:port as reached from the workshop session (can be repeated)",
+	)
+	c.Flags().BoolVar(
+		&o.Multiplex,
+		"multiplex",
+		true,
+		"share one websocket for all connections if the tunnel server supports it",
+	)
+	c.Flags().DurationVar(
+		&o.PingInterval,
+		"ping-interval",
+		tunnel.DefaultPingInterval,
+		"interval between keepalive pings sent to the tunnel server",
+	)
+	c.Flags().DurationVar(
+		&o.IdleTimeout,
+		"idle-timeout",
+		0,
+		"close a connection when no data has been sent or received for this long",
+	)
+	c.Flags().IntVar(
+		&o.Retries,
+		"retries",
+		5,
+		"number of times to retry connecting to the tunnel server",
+	)
+
+	return c
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/tunnel-manager/pkg/tunnel"
+)
+
+type TunnelServeOptions struct {
+	Listen         string
+	Path           string
+	Target         string
+	Token          string
+	InsecureNoAuth bool
+	Multiplex      bool
+	AllowTargets   []string
+	PingInterval   time.Duration
+	IdleTimeout    time.Duration
+}
+
+// allowTarget returns whether a multiplexed stream can be opened to a target
+// other than the default, with "*" allowing any target.
+func (o *TunnelServeOptions) allowTarget(target string) bool {
+	for _, allowed := range o.AllowTargets {
+		if allowed == "*" || allowed == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *TunnelServeOptions) Run(cmd *cobra.Command) error {
+	if _, _, err := net.SplitHostPort(o.Target); err != nil {
+		return errors.Errorf("invalid target %q, must be host:port", o.Target)
+	}
+
+	if !strings.HasPrefix(o.Path, "/") {
+		return errors.Errorf("invalid path %q, must start with /", o.Path)
+	}
+
+	for _, target := range o.AllowTargets {
+		if target == "*" {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return errors.Errorf("invalid allowed target %q, must be host:port or *", target)
+		}
+	}
+
+	if o.Token == "" {
+		o.Token = os.Getenv("EDUCATES_TUNNEL_TOKEN")
+	}
+
+	// Without a token, allowing other targets would let anyone who can reach
+	// the tunnel server use it to connect to those hosts, so this must be
+	// explicitly asked for.
+
+	if o.Token == "" && len(o.AllowTargets) != 0 && !o.InsecureNoAuth {
+		return errors.New("--allow-target requires a token unless --insecure-no-auth is also given")
+	}
+
+	tunnelServer := &tunnel.Server{
+		Target:       o.Target,
+		Token:        o.Token,
+		Multiplex:    o.Multiplex,
+		AllowTarget:  o.allowTarget,
+		PingInterval: o.PingInterval,
+		IdleTimeout:  o.IdleTimeout,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(cmd.ErrOrStderr(), format+"\n", args...)
+		},
+	}
+
+	// Clients cannot be browsers when a token is required, as they cannot
+	// set the Authorization header, so the origin need not be checked.
+
+	if o.Token != "" {
+		tunnelServer.CheckOrigin = func(r *http.Request) bool { return true }
+	}
+
+	defer tunnelServer.Close()
+
+	router := http.NewServeMux()
+
+	router.Handle(o.Path, tunnelServer)
+
+	server := http.Server{
+		Handler: router,
+	}
+
+	listener, err := net.Listen("tcp", o.Listen)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to listen on %s", o.Listen)
+	}
+
+	defer listener.Close()
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Tunnel server listening on %s%s for %s\n", listener.Addr(), o.Path, o.Target)
+
+	if o.Token == "" {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Warning: no token given, connections will not be authenticated")
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "tunnel server failed")
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "failed to shutdown tunnel server")
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewTunnelServeCmd() *cobra.Command {
+	var o TunnelServeOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "serve",
+		Short: "Run a tunnel server relaying websocket connections to a TCP port",
+		Long: "Run a tunnel server relaying websocket connections to a TCP port, such as " +
+			"an SSH daemon, using the same protocol as the tunnel server of a cluster. " +
+			"This can be used where workshops are deployed using docker, or for testing " +
+			"the tunnel commands against a local SSH daemon. The token can also be given " +
+			"by the EDUCATES_TUNNEL_TOKEN environment variable. Without a token, clients " +
+			"can only connect to the target, unless --insecure-no-auth is given.",
+		RunE: func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVar(
+		&o.Listen,
+		"listen",
+		"127.0.0.1:8080",
+		"address and port to accept websocket connections on",
+	)
+	c.Flags().StringVar(
+		&o.Path,
+		"path",
+		"/tunnel/",
+		"URL path to accept websocket connections on",
+	)
+	c.Flags().StringVar(
+		&o.Target,
+		"target",
+		"127.0.0.1:22",
+		"host and port to relay connections to",
+	)
+	c.Flags().StringVar(
+		&o.Token,
+		"token",
+		"",
+		"bearer token clients must supply to connect",
+	)
+	c.Flags().BoolVar(
+		&o.InsecureNoAuth,
+		"insecure-no-auth",
+		false,
+		"allow additional targets to be connected to without a token",
+	)
+	c.Flags().BoolVar(
+		&o.Multiplex,
+		"multiplex",
+		true,
+		"allow clients to multiplex several streams over one websocket",
+	)
+	c.Flags().StringArrayVar(
+		&o.AllowTargets,
+		"allow-target",
+		[]string{},
+		"additional host:port multiplexed streams can connect to, or * for any (can be repeated)",
+	)
+	c.Flags().DurationVar(
+		&o.PingInterval,
+		"ping-interval",
+		tunnel.DefaultPingInterval,
+		"interval between keepalive pings sent to clients",
+	)
+	c.Flags().DurationVar(
+		&o.IdleTimeout,
+		"idle-timeout",
+		0,
+		"close a connection when no data has been sent or received for this long",
+	)
+
+	return c
+}
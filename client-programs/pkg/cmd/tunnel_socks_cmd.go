@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/educates/educates-training-platform/tunnel-manager/pkg/tunnel"
+)
+
+type TunnelSocksOptions struct {
+	TunnelAuthOptions
+	Listen       string
+	PingInterval time.Duration
+	IdleTimeout  time.Duration
+	Retries      int
+}
+
+func (o *TunnelSocksOptions) Run(cmd *cobra.Command) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dialer := &tunnel.Dialer{
+		PingInterval: o.PingInterval,
+		IdleTimeout:  o.IdleTimeout,
+		Retries:      o.Retries,
+		MaxBackoff:   10 * time.Second,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(cmd.ErrOrStderr(), format+"\n", args...)
+		},
+	}
+
+	if err := o.configureDialer(dialer); err != nil {
+		return err
+	}
+
+	// Connections through the proxy can be to any address, so they must be
+	// multiplexed over the tunnel, as otherwise only the target of the tunnel
+	// server can be reached.
+
+	session := tunnel.NewSession(dialer, true)
+
+	defer session.Close()
+
+	// The tunnel server deployed with a workshop session only relays to
+	// its SSH daemon, so check up front that multiplexing is supported,
+	// rather than every connection through the proxy failing later, in case
+	// the URL given is for one of those.
+
+	if err := session.Probe(ctx); err != nil {
+		if errors.Is(err, tunnel.ErrMuxNotSupported) {
+			return errors.Errorf("tunnel server at %s does not support multiplexing, a tunnel server run using \"educates tunnel serve\" is required", dialer.URL)
+		}
+
+		return errors.Wrapf(err, "unable to connect to tunnel server at %s", dialer.URL)
+	}
+
+	listener, err := net.Listen("tcp", o.Listen)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to listen on %s", o.Listen)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "SOCKS5 proxy listening on %s for %s\n", listener.Addr(), dialer.URL)
+
+	return tunnel.ServeSOCKS(ctx, listener, session)
+}
+
+func (p *ProjectInfo) NewTunnelSocksCmd() *cobra.Command {
+	var o TunnelSocksOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "socks",
+		Short: "Run a local SOCKS5 proxy connecting via a tunnel server",
+		Long: "Run a local SOCKS5 proxy, with each connection made through the proxy " +
+			"being multiplexed over a websocket tunnel and made from the tunnel server. " +
+			"This requires a tunnel server run using \"educates tunnel serve\", with " +
+			"--allow-target giving the targets which can be reached. It cannot be used " +
+			"with the tunnel server deployed with a workshop session, which only relays " +
+			"connections to the SSH daemon of the workshop session.",
+		RunE: func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVar(
+		&o.Url,
+		"url",
+		"",
+		"URL of websocket for connecting to tunnel server",
+	)
+	c.Flags().StringVar(
+		&o.Token,
+		"token",
+		"",
+		"bearer token to authenticate with the tunnel server",
+	)
+	c.Flags().StringArrayVar(
+		&o.Cookies,
+		"cookie",
+		[]string{},
+		"cookie to send when connecting, as name=value (can be repeated)",
+	)
+	c.Flags().StringVar(
+		&o.Listen,
+		"listen",
+		"127.0.0.1:1080",
+		"local address and port for the SOCKS5 proxy to accept connections on",
+	)
+	c.Flags().DurationVar(
+		&o.PingInterval,
+		"ping-interval",
+		tunnel.DefaultPingInterval,
+		"interval between keepalive pings sent to the tunnel server",
+	)
+	c.Flags().DurationVar(
+		&o.IdleTimeout,
+		"idle-timeout",
+		0,
+		"close the tunnel when no data has been sent or received for this long",
+	)
+	c.Flags().IntVar(
+		&o.Retries,
+		"retries",
+		5,
+		"number of times to retry connecting to the tunnel server",
+	)
+
+	c.MarkFlagRequired("url")
+
+	return c
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
+	"github.com/educates/educates-training-platform/client-programs/pkg/sshconfig"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type TunnelSSHConfigOptions struct {
+	KubeconfigOptions
+	Portal  string
+	Session string
+	Write   bool
+}
+
+func (o *TunnelSSHConfigOptions) Run(cmd *cobra.Command) error {
+	clusterConfig, err := cluster.NewClusterConfigIfAvailable(o.Kubeconfig, o.Context)
+
+	if err != nil {
+		return err
+	}
+
+	details, err := lookupWorkshopSessionTunnel(clusterConfig, o.Portal, o.Session)
+
+	if err != nil {
+		return err
+	}
+
+	client, err := clusterConfig.GetClient()
+
+	if err != nil {
+		return err
+	}
+
+	// The SSH key pair for the workshop user is held in a secret in the
+	// workshop namespace, named after the session namespace.
+
+	secretsClient := client.CoreV1().Secrets(details.Environment)
+
+	secret, err := secretsClient.Get(context.TODO(), details.Namespace+"-ssh-keys", metav1.GetOptions{})
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to fetch SSH keys for workshop session %q", o.Session)
+	}
+
+	privateKey := secret.Data["id_rsa"]
+
+	if len(privateKey) == 0 {
+		return errors.Errorf("no SSH private key for workshop session %q", o.Session)
+	}
+
+	if !strings.HasSuffix(string(privateKey), "\n") {
+		privateKey = append(privateKey, '\n')
+	}
+
+	sshConfig, err := sshconfig.NewConfig()
+
+	if err != nil {
+		return err
+	}
+
+	keyFile := sshConfig.KeyFile(details.Hostname)
+
+	block, err := o.hostBlock(details, keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	// The private key is only saved when adding the SSH config, otherwise
+	// where it would be saved is shown so it can be saved separately.
+
+	if !o.Write {
+		fmt.Fprint(cmd.OutOrStdout(), block)
+		fmt.Fprintf(cmd.ErrOrStderr(), "SSH private key not saved, use --write to save it to %s.\n", keyFile)
+		return nil
+	}
+
+	if err := sshConfig.WriteKey(details.Hostname, privateKey); err != nil {
+		return err
+	}
+
+	entry := &sshconfig.Entry{
+		Portal:  o.Portal,
+		Session: o.Session,
+		Host:    details.Hostname,
+		Block:   block,
+	}
+
+	if err := sshConfig.AddEntry(entry); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Added SSH config for workshop session %q, use \"ssh %s\" to connect.\n", o.Session, details.Hostname)
+
+	return nil
+}
+
+// hostBlock returns the SSH config for accessing the workshop session, with
+// the SSH connection being made through the tunnel by this program.
+func (o *TunnelSSHConfigOptions) hostBlock(details *workshopSessionTunnel, keyFile string) (string, error) {
+	program, err := os.Executable()
+
+	if err != nil {
+		program = "educates"
+	}
+
+	args := []string{program, "tunnel", "connect", "--portal", o.Portal, "--session", o.Session}
+
+	if o.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", o.Kubeconfig)
+	}
+
+	if o.Context != "" {
+		args = append(args, "--context", o.Context)
+	}
+
+	// Options for network connections need to be passed on as well, with
+	// file paths made absolute as ssh runs the command from elsewhere.
+
+	httpOptions := httpclient.CurrentOptions()
+
+	for _, name := range httpOptions.CAFiles {
+		if absName, err := filepath.Abs(name); err == nil {
+			name = absName
+		}
+
+		args = append(args, "--ca-file", name)
+	}
+
+	if httpOptions.InsecureSkipTLSVerify {
+		args = append(args, "--insecure-skip-tls-verify")
+	}
+
+	var proxyCommand []string
+
+	for _, arg := range args {
+		quoted, err := quoteSSHConfigArg(arg)
+
+		if err != nil {
+			return "", err
+		}
+
+		proxyCommand = append(proxyCommand, quoted)
+	}
+
+	quotedKeyFile, err := quoteSSHConfigArg(keyFile)
+
+	if err != nil {
+		return "", err
+	}
+
+	// The host key for a workshop session is different each time a session
+	// is created, even where the hostname is reused, so it is not recorded.
+
+	var block strings.Builder
+
+	fmt.Fprintf(&block, "Host %s\n", details.Hostname)
+	fmt.Fprintf(&block, "  User %s\n", details.User)
+	fmt.Fprintf(&block, "  StrictHostKeyChecking no\n")
+	fmt.Fprintf(&block, "  UserKnownHostsFile /dev/null\n")
+	fmt.Fprintf(&block, "  LogLevel ERROR\n")
+	fmt.Fprintf(&block, "  IdentitiesOnly yes\n")
+	fmt.Fprintf(&block, "  IdentityFile %s\n", quotedKeyFile)
+	fmt.Fprintf(&block, "  ProxyCommand %s\n", strings.Join(proxyCommand, " "))
+
+	return block.String(), nil
+}
+
+// quoteSSHConfigArg quotes an argument in SSH config where it contains
+// whitespace. SSH config has no way of escaping characters within double
+// quotes, so an argument containing a double quote is rejected.
+func quoteSSHConfigArg(value string) (string, error) {
+	if strings.Contains(value, "\"") {
+		return "", errors.Errorf("cannot use %q in SSH config as it contains a double quote", value)
+	}
+
+	if strings.ContainsAny(value, " \t") {
+		return "\"" + value + "\"", nil
+	}
+
+	return value, nil
+}
+
+func (p *ProjectInfo) NewTunnelSSHConfigCmd() *cobra.Command {
+	var o TunnelSSHConfigOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "ssh-config",
+		Short: "Generate SSH config for accessing a workshop session",
+		RunE:  func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVar(
+		&o.Kubeconfig,
+		"kubeconfig",
+		"",
+		"kubeconfig file to use instead of $KUBECONFIG or $HOME/.kube/config",
+	)
+	c.Flags().StringVar(
+		&o.Context,
+		"context",
+		"",
+		"Context to use from Kubeconfig",
+	)
+	c.Flags().StringVarP(
+		&o.Portal,
+		"portal",
+		"p",
+		"",
+		"name of the training portal the workshop session belongs to",
+	)
+	c.Flags().StringVarP(
+		&o.Session,
+		"session",
+		"s",
+		"",
+		"name of the workshop session to generate SSH config for",
+	)
+	c.Flags().BoolVar(
+		&o.Write,
+		"write",
+		false,
+		"save the private key and add the SSH config to ~/.ssh/config instead of displaying it",
+	)
+
+	c.MarkFlagRequired("portal")
+	c.MarkFlagRequired("session")
+
+	c.AddCommand(
+		p.NewTunnelSSHConfigListCmd(),
+		p.NewTunnelSSHConfigRemoveCmd(),
+	)
+
+	return c
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/educates/educates-training-platform/client-programs/pkg/sshconfig"
+)
+
+type TunnelSSHConfigListOptions struct{}
+
+func (o *TunnelSSHConfigListOptions) Run(cmd *cobra.Command) error {
+	sshConfig, err := sshconfig.NewConfig()
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := sshConfig.Entries()
+
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No SSH config for workshop sessions found.")
+		return nil
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(cmd.OutOrStdout(), 8, 8, 3, ' ', 0)
+
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s\t%s\t%s\n", "PORTAL", "SESSION", "HOST")
+
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Portal, entry.Session, entry.Host)
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewTunnelSSHConfigListCmd() *cobra.Command {
+	var o TunnelSSHConfigListOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "list",
+		Short: "List workshop sessions added to SSH config",
+		RunE:  func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	return c
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/educates/educates-training-platform/client-programs/pkg/sshconfig"
+)
+
+type TunnelSSHConfigRemoveOptions struct {
+	Portal  string
+	Session string
+	All     bool
+}
+
+func (o *TunnelSSHConfigRemoveOptions) Run(cmd *cobra.Command) error {
+	sshConfig, err := sshconfig.NewConfig()
+
+	if err != nil {
+		return err
+	}
+
+	var entries []*sshconfig.Entry
+
+	if o.All {
+		entries, err = sshConfig.Entries()
+
+		if err != nil {
+			return err
+		}
+	} else {
+		entries = []*sshconfig.Entry{{Portal: o.Portal, Session: o.Session}}
+	}
+
+	for _, entry := range entries {
+		removed, err := sshConfig.RemoveEntry(entry.Portal, entry.Session)
+
+		if err != nil {
+			return err
+		}
+
+		if removed == nil {
+			return errors.Errorf("no SSH config for workshop session %q of training portal %q", entry.Session, entry.Portal)
+		}
+
+		if removed.Host != "" {
+			if err := sshConfig.RemoveKey(removed.Host); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed SSH config for workshop session %q.\n", removed.Session)
+	}
+
+	return nil
+}
+
+func (p *ProjectInfo) NewTunnelSSHConfigRemoveCmd() *cobra.Command {
+	var o TunnelSSHConfigRemoveOptions
+
+	var c = &cobra.Command{
+		Args:  cobra.NoArgs,
+		Use:   "remove",
+		Short: "Remove workshop session from SSH config",
+		RunE:  func(cmd *cobra.Command, _ []string) error { return o.Run(cmd) },
+	}
+
+	c.Flags().StringVarP(
+		&o.Portal,
+		"portal",
+		"p",
+		"",
+		"name of the training portal the workshop session belongs to",
+	)
+	c.Flags().StringVarP(
+		&o.Session,
+		"session",
+		"s",
+		"",
+		"name of the workshop session to remove SSH config for",
+	)
+	c.Flags().BoolVar(
+		&o.All,
+		"all",
+		false,
+		"remove SSH config for all workshop sessions",
+	)
+
+	c.MarkFlagsRequiredTogether("portal", "session")
+	c.MarkFlagsOneRequired("session", "all")
+	c.MarkFlagsMutuallyExclusive("session", "all")
+
+	return c
+}
@@ -229,15 +229,17 @@ func (c *ClusterDiagnosticsFetcher) fetchTrainingPortalDetailsAtRest(fileNamePat
 			c.clusterConfig,
 			trainingPortalName,
 		)
-		logout, err := catalogApiRequester.Login()
-		defer logout()
+		err := catalogApiRequester.Login(context.TODO())
 		if err != nil {
 			return errors.Wrap(err, "failed to login to training portal")
 		}
+		// Revoke the access token when done, rather than leaving a token
+		// saved for every training portal in the cluster.
+		defer catalogApiRequester.Logout(context.TODO())
 
 		// Get the list of workshops so we can know which workshop environment
 		// we need to request a workshop from.
-		listEnvironmentsResult, err := catalogApiRequester.GetWorkshopsCatalog()
+		listEnvironmentsResult, err := catalogApiRequester.GetWorkshopsCatalog(context.TODO())
 		if err != nil {
 			return errors.Wrap(err, "failed to get workshops catalog")
 		}
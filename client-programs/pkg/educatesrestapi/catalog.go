@@ -1,7 +1,6 @@
 package educatesrestapi
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -9,11 +8,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -29,16 +31,20 @@ type AuthDetails struct {
 }
 
 type WorkshopsCatalogRequesterApi interface {
-	GetWorkshopsCatalog() (*WorkshopsCatalogResponse, error)
-	Login() (func(), error)
-	// Logout() error
+	GetWorkshopsCatalog(ctx context.Context) (*WorkshopsCatalogResponse, error)
+	Login(ctx context.Context) error
+	Logout(ctx context.Context) error
 }
 
 type WorkshopsCatalogRequester struct {
 	clusterConfig *cluster.ClusterConfig
 	portalName    string
+	access        *PortalAccess
 	PortalUrl     string
 	Auth          *AuthDetails
+
+	mutex   sync.Mutex
+	expires time.Time
 }
 
 var _ WorkshopsCatalogRequesterApi = &WorkshopsCatalogRequester{}
@@ -50,244 +56,153 @@ func NewWorkshopsCatalogRequester(clusterConfig *cluster.ClusterConfig, portalNa
 	}
 }
 
-func (c *WorkshopsCatalogRequester) GetWorkshopsCatalog() (*WorkshopsCatalogResponse, error) {
-	body := []byte("{}")
-
-	requestURL := fmt.Sprintf("%s/workshops/catalog/environments", c.PortalUrl)
-
-	req, err := http.NewRequest("GET", requestURL, bytes.NewBuffer(body))
-
-	if err != nil {
-		return nil, errors.Wrap(err, "malformed request for training portal")
+// NewWorkshopsCatalogRequesterForPortal returns a requester for the training
+// portal at the URL given by access, using the credentials given by it rather
+// than reading them from the training portal resource in the cluster. The
+// portal name is only used to identify the saved access token.
+func NewWorkshopsCatalogRequesterForPortal(portalName string, access *PortalAccess) *WorkshopsCatalogRequester {
+	return &WorkshopsCatalogRequester{
+		portalName: portalName,
+		access:     access,
 	}
+}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Auth.AccessToken))
+// Client returns a client for making calls against the REST API of the
+// training portal, using the access token obtained when logging in. It can
+// be called while other clients are renewing the access token.
+func (c *WorkshopsCatalogRequester) Client() *PortalClient {
+	c.mutex.Lock()
 
-	res, err := http.DefaultClient.Do(req)
+	portalUrl := c.PortalUrl
+	accessToken := ""
 
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to request catalog from training portal")
+	if c.Auth != nil {
+		accessToken = c.Auth.AccessToken
 	}
 
-	defer res.Body.Close()
+	c.mutex.Unlock()
 
-	if res.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(res.Body)
+	client := NewPortalClient(portalUrl, accessToken)
 
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read response body from training portal")
-		}
+	client.Token = c.Token
 
-		bodyString := string(bodyBytes)
+	return client
+}
 
-		return nil, errors.Errorf("request for catalog from training portal failed with error (%d, %s)", res.StatusCode, bodyString)
-	}
+func (c *WorkshopsCatalogRequester) GetWorkshopsCatalog(ctx context.Context) (*WorkshopsCatalogResponse, error) {
+	workshopsCatalogResult, err := c.Client().ListEnvironments(ctx, nil)
 
-	workshopsCatalogResult := &WorkshopsCatalogResponse{}
-	err = json.NewDecoder(res.Body).Decode(workshopsCatalogResult)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode response from training portal")
+		return nil, errors.Wrap(err, "failed to request catalog from training portal")
 	}
 
 	return workshopsCatalogResult, nil
 }
 
-func (c *WorkshopsCatalogRequester) ExtendWorkshopSession(sessionName string) (*WorkshopSessionDetails, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/workshops/session/%s/extend/", c.PortalUrl, sessionName), nil)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "malformed request for training portal")
-	}
-
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Auth.AccessToken))
-
-	res, err := http.DefaultClient.Do(req)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot connect to training portal")
-	}
-
-	if res.StatusCode == 400 || res.StatusCode == 404 {
-		return nil, errors.New("No session found.")
-	}
-
-	if res.StatusCode != 200 {
-		return nil, errors.New("cannot execute session extension against training portal")
-	}
-
-	resBody, err := io.ReadAll(res.Body)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot read response to extend request")
-	}
-
-	var details *WorkshopSessionDetails
-
-	err = json.Unmarshal(resBody, &details)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot decode session details")
-	}
-
-	return details, nil
+func (c *WorkshopsCatalogRequester) ExtendWorkshopSession(ctx context.Context, sessionName string) (*WorkshopSessionDetails, error) {
+	return c.Client().ExtendSession(ctx, sessionName)
 }
 
-func (c *WorkshopsCatalogRequester) GetWorkshopSession(sessionName string) (*WorkshopSessionDetails, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/workshops/session/%s/schedule/", c.PortalUrl, sessionName), nil)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "malformed request for training portal")
-	}
-
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Auth.AccessToken))
-
-	res, err := http.DefaultClient.Do(req)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot connect to training portal")
-	}
-
-	if res.StatusCode == 400 || res.StatusCode == 404 {
-		return nil, errors.New("No session found.")
-	}
-
-	if res.StatusCode != 200 {
-		return nil, errors.New("cannot get session status from training portal")
-	}
-
-	resBody, err := io.ReadAll(res.Body)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot read response to status request")
-	}
-
-	var details *WorkshopSessionDetails
-
-	err = json.Unmarshal(resBody, &details)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot decode session details")
-	}
-
-	return details, nil
+func (c *WorkshopsCatalogRequester) GetWorkshopSession(ctx context.Context, sessionName string) (*WorkshopSessionDetails, error) {
+	return c.Client().GetSessionSchedule(ctx, sessionName)
 }
 
-func (c *WorkshopsCatalogRequester) TerminateWorkshopSession(sessionName string) (*WorkshopSessionDetails, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/workshops/session/%s/terminate/", c.PortalUrl, sessionName), nil)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "malformed request for training portal")
-	}
-
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Auth.AccessToken))
-
-	res, err := http.DefaultClient.Do(req)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot connect to training portal")
-	}
-
-	if res.StatusCode == 400 || res.StatusCode == 404 {
-		return nil, errors.New("No session found.")
-	}
-
-	if res.StatusCode != 200 {
-		return nil, errors.New("cannot execute session terminate against training portal")
-	}
-
-	resBody, err := io.ReadAll(res.Body)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot read response to termination request")
-	}
-
-	var details *WorkshopSessionDetails
-
-	err = json.Unmarshal(resBody, &details)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot decode session details")
-	}
-
-	return details, nil
+func (c *WorkshopsCatalogRequester) TerminateWorkshopSession(ctx context.Context, sessionName string) (*WorkshopSessionDetails, error) {
+	return c.Client().TerminateSession(ctx, sessionName)
 }
 
-func (c *WorkshopsCatalogRequester) RequestWorkshop(workshopName string, environmentName string, params map[string]string, indexUrl string, user string, timeout int) (*RequestWorkshopResponse, error) {
-
-	inputData := RequestWorkshopRequest{
+func (c *WorkshopsCatalogRequester) RequestWorkshop(ctx context.Context, workshopName string, environmentName string, params map[string]string, indexUrl string, user string, timeout int) (*RequestWorkshopResponse, error) {
+	options := &RequestWorkshopOptions{
+		IndexURL:   indexUrl,
+		User:       user,
+		Timeout:    timeout,
 		Parameters: []Parameter{},
 	}
 
 	for name, value := range params {
-		inputData.Parameters = append(inputData.Parameters, Parameter{name, value})
+		options.Parameters = append(options.Parameters, Parameter{name, value})
 	}
 
-	body, err := json.Marshal(inputData)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "cannot marshal request parameters")
-	}
+	client := c.Client()
 
-	if indexUrl == "" {
-		indexUrl = fmt.Sprintf("%s/accounts/logout/", c.PortalUrl)
-	}
-
-	queryString := url.Values{}
-	queryString.Add("index_url", indexUrl)
-	queryString.Add("timeout", fmt.Sprintf("%d", timeout))
-
-	if user != "" {
-		queryString.Add("user", user)
+	if options.IndexURL == "" {
+		options.IndexURL = fmt.Sprintf("%s/accounts/logout/", client.PortalUrl)
 	}
 
 	fmt.Printf("Requesting workshop %q from training portal %q.\n", workshopName, c.portalName)
 
-	requestURL := fmt.Sprintf("%s/workshops/environment/%s/request/?%s", c.PortalUrl, environmentName, queryString.Encode())
-
-	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer(body))
-
-	if err != nil {
-		return nil, errors.Wrap(err, "malformed request for training portal")
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Auth.AccessToken))
-
-	res, err := http.DefaultClient.Do(req)
+	requestWorkshopResult, err := client.RequestWorkshop(ctx, environmentName, options)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to request workshop from training portal")
 	}
 
-	defer res.Body.Close()
+	return requestWorkshopResult, nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(res.Body)
+// portalCredentials holds the OAuth client and robot account credentials
+// for accessing the REST API of a training portal.
+type portalCredentials struct {
+	clientId     string
+	clientSecret string
+	username     string
+	password     string
+}
 
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to read response body from training portal")
-		}
+// PortalAccess is the URL of a training portal and the credentials for
+// accessing its REST API, for where these are not read from the training
+// portal resource in the cluster, such as for a training portal run outside
+// of the cluster when testing.
+type PortalAccess struct {
+	URL          string
+	ClientId     string
+	ClientSecret string
+	Username     string
+	Password     string
+}
 
-		bodyString := string(bodyBytes)
+// PortalAccessFromEnv returns the URL and credentials of a training portal
+// given by the EDUCATES_PORTAL_URL, EDUCATES_PORTAL_CLIENT_ID,
+// EDUCATES_PORTAL_CLIENT_SECRET, EDUCATES_PORTAL_USERNAME and
+// EDUCATES_PORTAL_PASSWORD environment variables, or nil if
+// EDUCATES_PORTAL_URL is not set.
+func PortalAccessFromEnv() *PortalAccess {
+	portalUrl := os.Getenv("EDUCATES_PORTAL_URL")
 
-		return nil, errors.Errorf("request for workshop from training portal failed with error (%d, %s)", res.StatusCode, bodyString)
+	if portalUrl == "" {
+		return nil
 	}
 
-	requestWorkshopResult := &RequestWorkshopResponse{}
-
-	err = json.NewDecoder(res.Body).Decode(requestWorkshopResult)
-
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode response from training portal")
+	return &PortalAccess{
+		URL:          portalUrl,
+		ClientId:     os.Getenv("EDUCATES_PORTAL_CLIENT_ID"),
+		ClientSecret: os.Getenv("EDUCATES_PORTAL_CLIENT_SECRET"),
+		Username:     os.Getenv("EDUCATES_PORTAL_USERNAME"),
+		Password:     os.Getenv("EDUCATES_PORTAL_PASSWORD"),
 	}
-
-	return requestWorkshopResult, nil
 }
 
-func (c *WorkshopsCatalogRequester) Login() (func(), error) {
+// lookupPortalCredentials reads the credentials for accessing the REST API
+// from the status of the training portal resource, also setting the URL of
+// the training portal. Where the requester was given the URL and credentials
+// of the training portal, they are used instead.
+func (c *WorkshopsCatalogRequester) lookupPortalCredentials(ctx context.Context) (*portalCredentials, error) {
 	var err error
-	clientId := ""
-	clientSecret := ""
+
+	if c.access != nil {
+		if c.access.Username == "" || c.access.Password == "" {
+			return nil, errors.New("invalid credentials for training portal")
+		}
+
+		c.PortalUrl = strings.TrimSuffix(c.access.URL, "/")
+
+		return &portalCredentials{
+			clientId:     c.access.ClientId,
+			clientSecret: c.access.ClientSecret,
+			username:     c.access.Username,
+			password:     c.access.Password,
+		}, nil
+	}
 
 	// We commented this out because cluster availability is checked on the caller cmd when cluster is needed
 	// if err := cluster.IsClusterAvailable(c.clusterConfig); err != nil {
@@ -305,10 +220,14 @@ func (c *WorkshopsCatalogRequester) Login() (func(), error) {
 	var trainingPortal *unstructured.Unstructured
 	var executions = 0
 	for {
-		trainingPortal, err = trainingPortalClient.Get(context.TODO(), c.portalName, metav1.GetOptions{})
+		trainingPortal, err = trainingPortalClient.Get(ctx, c.portalName, metav1.GetOptions{})
 
 		if k8serrors.IsNotFound(err) {
-			return nil, errors.New("No session found.")
+			return nil, errors.Wrapf(ErrPortalNotFound, "portal %q", c.portalName)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to retrieve training portal %q", c.portalName)
 		}
 
 		_, found, _ := unstructured.NestedMap(trainingPortal.Object, "status")
@@ -319,80 +238,75 @@ func (c *WorkshopsCatalogRequester) Login() (func(), error) {
 		if executions > 3 {
 			return nil, errors.New("Training portal does not yet have a status for credentials")
 		}
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "unable to retrieve training portal %q", c.portalName)
+		case <-time.After(1 * time.Second):
+		}
 		executions++
 	}
 
 	c.PortalUrl, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "url")
 
-	clientId, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "clients", "robot", "id")
-	clientSecret, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "clients", "robot", "secret")
+	credentials := &portalCredentials{}
+
+	credentials.clientId, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "clients", "robot", "id")
+	credentials.clientSecret, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "clients", "robot", "secret")
 
-	username, _, _ := unstructured.NestedString(trainingPortal.Object, "status", "educates", "credentials", "robot", "username")
-	password, _, _ := unstructured.NestedString(trainingPortal.Object, "status", "educates", "credentials", "robot", "password")
+	credentials.username, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "credentials", "robot", "username")
+	credentials.password, _, _ = unstructured.NestedString(trainingPortal.Object, "status", "educates", "credentials", "robot", "password")
 
 	if c.PortalUrl == "" {
 		return nil, errors.New("invalid URL endpoint in training portal")
 	}
 
-	if username == "" || password == "" {
+	if credentials.username == "" || credentials.password == "" {
 		return nil, errors.New("invalid credentials in training portal")
 	}
 
+	return credentials, nil
+}
+
+// passwordLogin requests an access token using the robot account
+// credentials for the training portal.
+func (c *WorkshopsCatalogRequester) passwordLogin(ctx context.Context, credentials *portalCredentials) error {
 	form := url.Values{}
 
 	form.Add("grant_type", "password")
-	form.Add("username", username)
-	form.Add("password", password)
-
-	// We try to login 5 times in case of errors (since this operation might have happen too fast
-	// with relation to the creation of the trainingportal) adding an exponential delay between each try
-	var resBody []byte
-	for executions := 0; executions < 6; executions++ {
-		resBody, err = requestToken(c.PortalUrl, clientId, clientSecret, form)
-		if err != nil {
-			time.Sleep(time.Duration(2*executions) * time.Second)
-			continue
-		}
-		if resBody != nil {
-			break
-		}
-	}
+	form.Add("username", credentials.username)
+	form.Add("password", credentials.password)
+
+	resBody, err := requestToken(ctx, c.PortalUrl, credentials.clientId, credentials.clientSecret, form)
+
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	err = json.Unmarshal(resBody, &c.Auth)
 
 	if err != nil {
-		return nil, errors.Wrapf(err, "cannot decode auth details")
+		return errors.Wrapf(err, "cannot decode auth details")
 	}
 
-	cleanupFunc := func() {
-		if c.PortalUrl == "" || c.Auth.AccessToken == "" {
-			return
-		}
-		form = url.Values{}
-
-		form.Add("token", c.Auth.AccessToken)
-		form.Add("client_id", clientId)
-		form.Add("client_secret", clientSecret)
-
-		req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth2/revoke-token/", c.PortalUrl), strings.NewReader(form.Encode()))
-
-		if err == nil {
-			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.Auth.AccessToken))
+	return nil
+}
 
-			_, _ = http.DefaultClient.Do(req)
-		}
-	}
+// Login sets the access token for the training portal, reusing the token
+// saved by an earlier command where there is one, so that commands run one
+// after another don't each need to login. The token is left valid when done
+// with, and can be revoked using Logout.
+func (c *WorkshopsCatalogRequester) Login(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	return cleanupFunc, nil
+	return c.LoginWithCachedToken(ctx, false)
 }
 
-func requestToken(portalUrl string, clientId string, clientSecret string, form url.Values) ([]byte, error) {
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/oauth2/token/", portalUrl), strings.NewReader(form.Encode()))
+// requestToken requests an access token from the training portal. The
+// request is retried where the training portal could not be connected to or
+// is not yet ready, as when it has only just been created.
+func requestToken(ctx context.Context, portalUrl string, clientId string, clientSecret string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth2/token/", portalUrl), strings.NewReader(form.Encode()))
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "malformed request for training portal")
@@ -403,22 +317,29 @@ func requestToken(portalUrl string, clientId string, clientSecret string, form u
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", credentials))
 
-	var res *http.Response
-
-	res, err = http.DefaultClient.Do(req)
+	res, err := tokenRetryPolicy.runWith(ctx, func(res *http.Response, err error) bool {
+		return tokenRetryable(ctx, res, err)
+	}, func() (*http.Response, error) {
+		attempt := req.Clone(ctx)
+		attempt.Body, _ = req.GetBody()
+		return httpclient.Client().Do(attempt)
+	})
 
 	if err != nil {
-		return nil, errors.New("cannot connect to training portal")
+		return nil, errors.Wrap(err, "cannot login to training portal")
 	}
-	if res.StatusCode == 503 {
-		return nil, errors.New("cannot login to training portal. Portal not ready yet")
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusServiceUnavailable {
+		return nil, errors.Wrap(newAPIError("POST", "/oauth2/token/", res), "cannot login to training portal, portal not ready yet")
 	}
-	if res.StatusCode != 200 {
-		return nil, errors.New("cannot login to training portal")
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(newAPIError("POST", "/oauth2/token/", res), "cannot login to training portal")
 	}
 
 	resBody, err := io.ReadAll(res.Body)
-	res.Body.Close()
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot read response to token request")
@@ -0,0 +1,250 @@
+package educatesrestapi_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi/fakeportal"
+)
+
+// newRequester returns a requester for the fake training portal, with the
+// name of the test used as the name of the training portal so that tests
+// don't share saved access tokens.
+func newRequester(t *testing.T, server *fakeportal.Server) *educatesrestapi.WorkshopsCatalogRequester {
+	return educatesrestapi.NewWorkshopsCatalogRequesterForPortal(t.Name(), &educatesrestapi.PortalAccess{
+		URL:          server.URL,
+		ClientId:     fakeportal.DefaultClientID,
+		ClientSecret: fakeportal.DefaultClientSecret,
+		Username:     fakeportal.DefaultUsername,
+		Password:     fakeportal.DefaultPassword,
+	})
+}
+
+func TestRequesterForPortal(t *testing.T) {
+	server := newServer(t, 1)
+	requester := newRequester(t, server)
+
+	if err := requester.Login(context.Background()); err != nil {
+		t.Fatalf("unable to login to training portal: %v", err)
+	}
+
+	catalog, err := requester.GetWorkshopsCatalog(context.Background())
+
+	if err != nil {
+		t.Fatalf("unable to get workshops catalog: %v", err)
+	}
+
+	if len(catalog.Environments) != 1 || catalog.Environments[0].Name != testEnvironment {
+		t.Fatalf("expected catalog to list workshop environment %s, got %+v", testEnvironment, catalog.Environments)
+	}
+
+	response, err := requester.RequestWorkshop(context.Background(), testWorkshop, testEnvironment, nil, "", "user-1", 60)
+
+	if err != nil {
+		t.Fatalf("unable to request workshop session: %v", err)
+	}
+
+	if _, err := requester.TerminateWorkshopSession(context.Background(), response.Name); err != nil {
+		t.Fatalf("unable to terminate workshop session: %v", err)
+	}
+
+	if err := requester.Logout(context.Background()); err != nil {
+		t.Fatalf("unable to logout from training portal: %v", err)
+	}
+
+	if count := server.CountRequests(http.MethodPost, "/oauth2/revoke-token/"); count != 2 {
+		t.Errorf("expected access and refresh tokens to be revoked, got %d requests", count)
+	}
+}
+
+func TestRequesterInvalidCredentials(t *testing.T) {
+	server := newServer(t, 0)
+
+	requester := educatesrestapi.NewWorkshopsCatalogRequesterForPortal(t.Name(), &educatesrestapi.PortalAccess{
+		URL: server.URL,
+	})
+
+	if err := requester.Login(context.Background()); err == nil {
+		t.Fatal("expected login without credentials to fail")
+	}
+
+	if count := server.CountRequests("", "/oauth2/token/"); count != 0 {
+		t.Errorf("expected no login to be attempted, got %d requests", count)
+	}
+}
+
+func TestRequesterCachedToken(t *testing.T) {
+	server := newServer(t, 0)
+
+	if err := newRequester(t, server).Login(context.Background()); err != nil {
+		t.Fatalf("unable to login to training portal: %v", err)
+	}
+
+	requester := newRequester(t, server)
+
+	if err := requester.Login(context.Background()); err != nil {
+		t.Fatalf("unable to login to training portal: %v", err)
+	}
+
+	if count := server.CountRequests(http.MethodPost, "/oauth2/token/"); count != 1 {
+		t.Errorf("expected saved access token to be reused, got %d logins", count)
+	}
+
+	if _, err := requester.GetWorkshopsCatalog(context.Background()); err != nil {
+		t.Fatalf("unable to get workshops catalog with saved access token: %v", err)
+	}
+}
+
+func TestRequesterTokenRenewed(t *testing.T) {
+	server := newServer(t, 0)
+	requester := newRequester(t, server)
+
+	if err := requester.Login(context.Background()); err != nil {
+		t.Fatalf("unable to login to training portal: %v", err)
+	}
+
+	client := requester.Client()
+
+	server.ExpireTokens()
+
+	// The training portal rejects the expired access token with a 403
+	// status, and the client then renews it using the refresh token.
+
+	if _, err := client.ListEnvironments(context.Background(), nil); err != nil {
+		t.Fatalf("expected call to succeed with renewed access token, got %v", err)
+	}
+
+	if count := server.CountRequests(http.MethodPost, "/oauth2/token/"); count != 2 {
+		t.Errorf("expected access token to be renewed once, got %d logins", count)
+	}
+}
+
+func TestRequesterNoSessionAvailable(t *testing.T) {
+	server := newServer(t, 1)
+	requester := newRequester(t, server)
+
+	if err := requester.Login(context.Background()); err != nil {
+		t.Fatalf("unable to login to training portal: %v", err)
+	}
+
+	if _, err := requester.RequestWorkshop(context.Background(), testWorkshop, testEnvironment, nil, "", "user-1", 60); err != nil {
+		t.Fatalf("unable to request workshop session: %v", err)
+	}
+
+	_, err := requester.RequestWorkshop(context.Background(), testWorkshop, testEnvironment, nil, "", "user-2", 60)
+
+	if !errors.Is(err, educatesrestapi.ErrNoSessionAvailable) {
+		t.Fatalf("expected ErrNoSessionAvailable, got %v", err)
+	}
+}
+
+func TestRequesterConcurrentClients(t *testing.T) {
+	server := newServer(t, 0)
+	requester := newRequester(t, server)
+
+	if err := requester.Login(context.Background()); err != nil {
+		t.Fatalf("unable to login to training portal: %v", err)
+	}
+
+	// Clients are created while others are renewing the access token, as
+	// when running a load test.
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			client := requester.Client()
+
+			if _, err := client.Token(context.Background(), true); err != nil {
+				t.Errorf("unable to renew access token: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestRequesterLoginRetried(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		succeeds   bool
+		attempts   int
+	}{
+		// The training portal may still be starting up, in which case the
+		// request is retried, but as the request is not idempotent, other
+		// server errors are not.
+
+		{"unavailable", http.StatusServiceUnavailable, true, 2},
+		{"server error", http.StatusInternalServerError, false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newServer(t, 0)
+			requester := newRequester(t, server)
+
+			server.InjectFault(fakeportal.Fault{
+				Method:     http.MethodPost,
+				Path:       "/oauth2/token/",
+				StatusCode: test.statusCode,
+				Times:      1,
+			})
+
+			err := requester.Login(context.Background())
+
+			if test.succeeds && err != nil {
+				t.Fatalf("expected login to succeed once retried, got %v", err)
+			}
+
+			if !test.succeeds && err == nil {
+				t.Fatal("expected login to fail")
+			}
+
+			if count := server.CountRequests(http.MethodPost, "/oauth2/token/"); count != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, count)
+			}
+		})
+	}
+}
+
+func TestRequesterLoginDeadline(t *testing.T) {
+	server := newServer(t, 0)
+	requester := newRequester(t, server)
+
+	server.InjectFault(fakeportal.Fault{
+		Method:     http.MethodPost,
+		Path:       "/oauth2/token/",
+		StatusCode: http.StatusServiceUnavailable,
+	})
+
+	// The context would be done before the request is retried, so it gives
+	// up straight away, reporting why the request failed.
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+
+	if err := requester.Login(ctx); !errors.Is(err, educatesrestapi.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected login to give up straight away, took %s", elapsed)
+	}
+
+	if count := server.CountRequests(http.MethodPost, "/oauth2/token/"); count != 1 {
+		t.Errorf("expected 1 attempt before the context was done, got %d", count)
+	}
+}
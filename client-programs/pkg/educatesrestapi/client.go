@@ -0,0 +1,627 @@
+package educatesrestapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
+)
+
+// PortalClient makes calls against the REST API of a training portal, using
+// an access token obtained by logging in with the credentials of the robot
+// account or an OAuth client. Calls which act through the web interface of
+// the training portal on behalf of a user, such as activating a workshop
+// session, keep the login session for the user in a cookie jar, so calls
+// made with the same client are made as the same user.
+type PortalClient struct {
+	// PortalUrl is the base URL of the training portal.
+	PortalUrl string
+
+	// AccessToken is the OAuth access token for the REST API.
+	AccessToken string
+
+	// Token, if set, is called for the access token for each call in place
+	// of using AccessToken, so that an expired token can be refreshed. If a
+	// call is rejected with a 401 or 403 status, it is called again with
+	// renew set and the call retried once, as the training portal responds
+	// with a 403 status when the access token is not valid.
+	Token func(ctx context.Context, renew bool) (string, error)
+
+	// HTTPClient is used to make requests, defaulting to the shared client
+	// for the CLI.
+	HTTPClient *http.Client
+
+	// Timeout, if not zero, limits how long each call can take, including
+	// any retries. It applies in addition to any deadline of the context
+	// passed to the call.
+	Timeout time.Duration
+
+	// Retry is the policy for retrying calls which fail in a way which may
+	// only be temporary.
+	Retry RetryPolicy
+
+	jar http.CookieJar
+}
+
+// NewPortalClient returns a client for the training portal at the URL, using
+// the access token to authenticate calls to the REST API. The client uses
+// DefaultTimeout and DefaultRetryPolicy, which can be changed before making
+// any calls.
+func NewPortalClient(portalUrl string, accessToken string) *PortalClient {
+	jar, _ := cookiejar.New(nil)
+
+	return &PortalClient{
+		PortalUrl:   strings.TrimSuffix(portalUrl, "/"),
+		AccessToken: accessToken,
+		Timeout:     DefaultTimeout,
+		Retry:       DefaultRetryPolicy,
+		jar:         jar,
+	}
+}
+
+// withTimeout returns the context for a call, limited by the timeout for the
+// client.
+func (c *PortalClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+func (c *PortalClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return httpclient.Client()
+}
+
+// browserClient returns a client for calls made through the web interface,
+// which keeps cookies and doesn't follow redirects, as where a call is
+// redirected to indicates whether it succeeded.
+func (c *PortalClient) browserClient() *http.Client {
+	client := *c.httpClient()
+
+	client.Jar = c.jar
+
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &client
+}
+
+// do makes a call against the REST API, with path being relative to the
+// "/workshops/" path of the training portal. The request body, if not nil,
+// is sent as JSON, and where out is not nil the response is decoded into it.
+// Calls made using an idempotent method are retried according to the retry
+// policy of the client.
+func (c *PortalClient) do(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	path = "/workshops/" + path
+
+	requestUrl := c.PortalUrl + path
+
+	if len(query) != 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	var data []byte
+
+	if in != nil {
+		var err error
+
+		data, err = json.Marshal(in)
+
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal request for training portal")
+		}
+	}
+
+	// Where the access token is rejected, only the first attempt of the
+	// retried call renews it.
+
+	attempt := func(renew bool) func() (*http.Response, error) {
+		return func() (*http.Response, error) {
+			res, err := c.send(ctx, method, requestUrl, data, renew)
+			renew = false
+			return res, err
+		}
+	}
+
+	idempotent := idempotentMethod(method)
+
+	res, err := c.Retry.run(ctx, idempotent, attempt(false))
+
+	if err == nil && (res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden) && c.Token != nil {
+		res.Body.Close()
+		res, err = c.Retry.run(ctx, idempotent, attempt(true))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return newAPIError(method, path, res)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "failed to decode response from training portal")
+	}
+
+	return nil
+}
+
+// send makes a single request against the REST API, with the access token
+// renewed first where renew is set and there is a Token function.
+func (c *PortalClient) send(ctx context.Context, method string, requestUrl string, data []byte, renew bool) (*http.Response, error) {
+	accessToken := c.AccessToken
+
+	if c.Token != nil {
+		var err error
+
+		accessToken, err = c.Token(ctx, renew)
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot login to training portal")
+		}
+	}
+
+	var body io.Reader
+
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, body)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed request for training portal")
+	}
+
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	res, err := c.httpClient().Do(req)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to training portal")
+	}
+
+	return res, nil
+}
+
+// newAPIError creates the error for a failed call from the response. Django
+// returns error messages as HTML unless a content type is given, in which
+// case there is no message.
+func newAPIError(method string, path string, res *http.Response) *APIError {
+	return &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: res.StatusCode,
+		Message:    httpclient.ErrorMessage(res),
+	}
+}
+
+// redirect makes a call through the web interface, returning where it was
+// redirected to. As calls through the web interface can create or change the
+// state of workshop sessions, they are only retried where the connection
+// could not be made.
+func (c *PortalClient) redirect(ctx context.Context, path string, query url.Values) (*url.URL, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	path = "/workshops/" + path
+
+	requestUrl := c.PortalUrl + path
+
+	if len(query) != 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed request for training portal")
+	}
+
+	client := c.browserClient()
+
+	res, err := c.Retry.run(ctx, false, func() (*http.Response, error) {
+		return client.Do(req.Clone(ctx))
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to training portal")
+	}
+
+	defer res.Body.Close()
+
+	location, err := res.Location()
+
+	if err != nil {
+		if res.StatusCode >= 400 {
+			return nil, newAPIError(http.MethodGet, path, res)
+		}
+
+		return nil, errors.Errorf("unexpected response from training portal for %s with status %d", path, res.StatusCode)
+	}
+
+	return location, nil
+}
+
+// WaitUntilReady waits until the training portal is accepting requests,
+// retrying while it can't be connected to or responds with a 5xx status,
+// until the context is done. The retry policy of the client is used for the
+// delay between attempts, but not the number of attempts.
+func (c *PortalClient) WaitUntilReady(ctx context.Context) error {
+	policy := c.Retry
+
+	policy.MaxAttempts = math.MaxInt
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.PortalUrl+"/", nil)
+
+	if err != nil {
+		return errors.Wrap(err, "malformed request for training portal")
+	}
+
+	res, err := policy.run(ctx, true, func() (*http.Response, error) {
+		return c.httpClient().Do(req.Clone(ctx))
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "training portal is not ready")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 500 {
+		return errors.Wrap(newAPIError(http.MethodGet, "/", res), "training portal is not ready")
+	}
+
+	return nil
+}
+
+// redirectError returns the error to report where a call through the web
+// interface was redirected somewhere other than expected, using the
+// notification added to the query string when redirected back to the index
+// page, or to the login page.
+func redirectError(path string, location *url.URL) error {
+	switch location.Query().Get("notification") {
+	case "workshop-invalid":
+		return errors.Wrapf(ErrNotFound, "workshop environment for %s", path)
+	case "session-invalid":
+		return errors.Wrapf(ErrNotFound, "workshop session for %s", path)
+	case "session-unavailable":
+		return errors.Wrapf(ErrNoSessionAvailable, "request for %s", path)
+	}
+
+	if strings.Contains(location.Path, "/login") {
+		return ErrLoginRequired
+	}
+
+	return errors.Errorf("unexpected redirect from training portal for %s to %s", path, location)
+}
+
+// sessionName returns the name of the workshop session where the location is
+// the page for the workshop session.
+func sessionName(location *url.URL) (string, bool) {
+	name, found := strings.CutPrefix(location.Path, "/workshops/session/")
+
+	if !found {
+		return "", false
+	}
+
+	name = strings.TrimSuffix(name, "/")
+
+	if name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+
+	return name, true
+}
+
+// ListEnvironments returns the workshop environments in the catalog, along
+// with details of the training portal.
+func (c *PortalClient) ListEnvironments(ctx context.Context, options *ListEnvironmentsOptions) (*WorkshopsCatalogResponse, error) {
+	query := url.Values{}
+
+	if options != nil {
+		for _, name := range options.Names {
+			query.Add("name", name)
+		}
+
+		for name, value := range options.Labels {
+			query.Add(fmt.Sprintf("labels[%s]", name), value)
+		}
+
+		for _, state := range options.States {
+			query.Add("state", state)
+		}
+
+		if options.Sessions {
+			query.Set("sessions", "true")
+		}
+	}
+
+	result := &WorkshopsCatalogResponse{}
+
+	if err := c.do(ctx, http.MethodGet, "catalog/environments/", query, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListWorkshops returns the workshops in the catalog which have a running
+// workshop environment, along with details of the training portal.
+func (c *PortalClient) ListWorkshops(ctx context.Context) (*WorkshopsListResponse, error) {
+	result := &WorkshopsListResponse{}
+
+	if err := c.do(ctx, http.MethodGet, "catalog/workshops/", nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetEnvironmentStatus returns the status of a workshop environment, which
+// can only be requested by a robot account. Where sessions is set the
+// allocated workshop sessions are included.
+func (c *PortalClient) GetEnvironmentStatus(ctx context.Context, environmentName string, sessions bool) (*EnvironmentDetails, error) {
+	query := url.Values{}
+
+	if sessions {
+		query.Set("sessions", "true")
+	}
+
+	result := &EnvironmentDetails{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("environment/%s/status/", environmentName), query, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RequestWorkshop requests a workshop session from a workshop environment on
+// behalf of a user, which can only be done by a robot account. The session
+// needs to be activated using the returned URL, or ActivateSession, before
+// the timeout given in the options expires.
+func (c *PortalClient) RequestWorkshop(ctx context.Context, environmentName string, options *RequestWorkshopOptions) (*RequestWorkshopResponse, error) {
+	if options == nil || options.IndexURL == "" {
+		return nil, errors.New("index URL is required when requesting workshop")
+	}
+
+	query := url.Values{}
+
+	query.Set("index_url", options.IndexURL)
+
+	if options.Timeout != 0 {
+		query.Set("timeout", strconv.Itoa(options.Timeout))
+	}
+
+	optional := map[string]string{
+		"user":          options.User,
+		"email":         options.Email,
+		"first_name":    options.FirstName,
+		"last_name":     options.LastName,
+		"session":       options.Session,
+		"analytics_url": options.AnalyticsURL,
+	}
+
+	for name, value := range optional {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	body := RequestWorkshopRequest{
+		Parameters: options.Parameters,
+	}
+
+	if body.Parameters == nil {
+		body.Parameters = []Parameter{}
+	}
+
+	result := &RequestWorkshopResponse{}
+
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("environment/%s/request/", environmentName), query, body, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CreateSession creates a workshop session from a workshop environment the
+// same as when a user does so through the web interface, returning the name
+// of the workshop session. Unless this client already holds a login session
+// for a user, this requires anonymous access to be enabled for the training
+// portal, with a new anonymous user being logged in.
+func (c *PortalClient) CreateSession(ctx context.Context, environmentName string, indexUrl string) (string, error) {
+	query := url.Values{}
+
+	if indexUrl != "" {
+		query.Set("index_url", indexUrl)
+	}
+
+	path := fmt.Sprintf("environment/%s/create/", environmentName)
+
+	location, err := c.redirect(ctx, path, query)
+
+	if err != nil {
+		return "", err
+	}
+
+	// When successful, this redirects to the page which allocates the
+	// workshop session, which in turn redirects to the workshop session.
+
+	if location.Path != fmt.Sprintf("/workshops/environment/%s/", environmentName) {
+		return "", redirectError(path, location)
+	}
+
+	path = fmt.Sprintf("environment/%s/", environmentName)
+
+	if location, err = c.redirect(ctx, path, location.Query()); err != nil {
+		return "", err
+	}
+
+	name, found := sessionName(location)
+
+	if !found {
+		return "", redirectError(path, location)
+	}
+
+	return name, nil
+}
+
+// ActivateSession activates a workshop session which was requested using
+// the REST API, with the token from the activation URL, after which this
+// client holds a login session for the owner of the workshop session.
+func (c *PortalClient) ActivateSession(ctx context.Context, sessionName string, token string) error {
+	query := url.Values{}
+
+	query.Set("token", token)
+
+	path := fmt.Sprintf("session/%s/activate/", sessionName)
+
+	location, err := c.redirect(ctx, path, query)
+
+	if err != nil {
+		return err
+	}
+
+	if location.Path != fmt.Sprintf("/workshops/session/%s/", sessionName) {
+		return redirectError(path, location)
+	}
+
+	return nil
+}
+
+// DeleteSession deletes a workshop session the same as when a user does so
+// through the web interface, which requires this client to hold a login
+// session for the owner of the workshop session, such as after calling
+// ActivateSession. Use TerminateSession with the REST API otherwise.
+func (c *PortalClient) DeleteSession(ctx context.Context, sessionName string) error {
+	path := fmt.Sprintf("session/%s/delete/", sessionName)
+
+	location, err := c.redirect(ctx, path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if location.Query().Get("notification") != "session-deleted" {
+		return redirectError(path, location)
+	}
+
+	return nil
+}
+
+// AuthorizeSession checks that the user the access token is for is permitted
+// to access a workshop session.
+func (c *PortalClient) AuthorizeSession(ctx context.Context, sessionName string) (*WorkshopSessionAuthorization, error) {
+	result := &WorkshopSessionAuthorization{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("session/%s/authorize/", sessionName), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetSessionConfig returns the URL and password for accessing a workshop
+// session directly.
+func (c *PortalClient) GetSessionConfig(ctx context.Context, sessionName string) (*WorkshopSessionConfig, error) {
+	result := &WorkshopSessionConfig{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("session/%s/config/", sessionName), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetSessionSchedule returns the status of a workshop session and how long
+// it is scheduled to run for.
+func (c *PortalClient) GetSessionSchedule(ctx context.Context, sessionName string) (*WorkshopSessionDetails, error) {
+	result := &WorkshopSessionDetails{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("session/%s/schedule/", sessionName), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ExtendSession extends how long a workshop session is scheduled to run for,
+// where it is close enough to expiring for that to be permitted. Whether it
+// was extended is indicated in the result.
+func (c *PortalClient) ExtendSession(ctx context.Context, sessionName string) (*WorkshopSessionDetails, error) {
+	result := &WorkshopSessionDetails{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("session/%s/extend/", sessionName), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// TerminateSession triggers deletion of a workshop session, returning when
+// it was started and when it would have expired.
+func (c *PortalClient) TerminateSession(ctx context.Context, sessionName string) (*WorkshopSessionDetails, error) {
+	result := &WorkshopSessionDetails{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("session/%s/terminate/", sessionName), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ReportSessionEvent reports an event for a workshop session, which is passed
+// on to any analytics webhook configured for the training portal.
+func (c *PortalClient) ReportSessionEvent(ctx context.Context, sessionName string, event WorkshopSessionEvent) error {
+	body := struct {
+		Event WorkshopSessionEvent `json:"event"`
+	}{event}
+
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("session/%s/event/", sessionName), nil, body, nil)
+}
+
+// ListUserSessions returns the workshop sessions a user currently has, which
+// can only be requested by a robot account.
+func (c *PortalClient) ListUserSessions(ctx context.Context, username string) (*UserSessionsResponse, error) {
+	result := &UserSessionsResponse{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("user/%s/sessions/", url.PathEscape(username)), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
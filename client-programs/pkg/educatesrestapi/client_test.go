@@ -0,0 +1,321 @@
+package educatesrestapi_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi/fakeportal"
+)
+
+const (
+	testWorkshop    = "lab-markdown-sample"
+	testEnvironment = "lab-markdown-sample-w01"
+	testIndexURL    = "https://example.com/"
+)
+
+// TestMain saves access tokens for training portals to a temporary directory,
+// rather than that of the user running the tests.
+func TestMain(m *testing.M) {
+	dataHome, err := os.MkdirTemp("", "educatesrestapi-test-")
+
+	if err != nil {
+		panic(err)
+	}
+
+	os.Setenv("XDG_DATA_HOME", dataHome)
+
+	xdg.Reload()
+
+	code := m.Run()
+
+	os.RemoveAll(dataHome)
+
+	os.Exit(code)
+}
+
+// newServer starts a fake training portal with a workshop environment which
+// has capacity for the number of workshop sessions.
+func newServer(t *testing.T, capacity int) *fakeportal.Server {
+	t.Helper()
+
+	server := fakeportal.NewServer()
+
+	t.Cleanup(server.Close)
+
+	server.AddEnvironment(fakeportal.Environment{
+		Name:     testEnvironment,
+		Workshop: educatesrestapi.WorkshopDetails{Name: testWorkshop},
+		Capacity: capacity,
+		Duration: 30 * time.Minute,
+	})
+
+	return server
+}
+
+// newClient returns a client for the fake training portal which retries
+// without waiting long between attempts.
+func newClient(server *fakeportal.Server) *educatesrestapi.PortalClient {
+	client := server.Client()
+
+	client.Retry = educatesrestapi.RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}
+
+	return client
+}
+
+func requestSession(t *testing.T, client *educatesrestapi.PortalClient, user string) *educatesrestapi.RequestWorkshopResponse {
+	t.Helper()
+
+	response, err := client.RequestWorkshop(context.Background(), testEnvironment, &educatesrestapi.RequestWorkshopOptions{
+		IndexURL: testIndexURL,
+		User:     user,
+	})
+
+	if err != nil {
+		t.Fatalf("unable to request workshop session: %v", err)
+	}
+
+	return response
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	server := newServer(t, 1)
+	client := newClient(server)
+
+	ctx := context.Background()
+
+	response := requestSession(t, client, "user-1")
+
+	if err := client.ActivateSession(ctx, response.Name, response.ActivationToken()); err != nil {
+		t.Fatalf("unable to activate workshop session: %v", err)
+	}
+
+	schedule, err := client.GetSessionSchedule(ctx, response.Name)
+
+	if err != nil {
+		t.Fatalf("unable to get schedule of workshop session: %v", err)
+	}
+
+	if schedule.Status != fakeportal.StateRunning {
+		t.Errorf("expected workshop session to be %s, got %s", fakeportal.StateRunning, schedule.Status)
+	}
+
+	if _, err := client.TerminateSession(ctx, response.Name); err != nil {
+		t.Fatalf("unable to terminate workshop session: %v", err)
+	}
+
+	if _, err := client.GetSessionSchedule(ctx, response.Name); !errors.Is(err, educatesrestapi.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for terminated workshop session, got %v", err)
+	}
+}
+
+func TestNoSessionAvailable(t *testing.T) {
+	server := newServer(t, 1)
+	client := newClient(server)
+
+	requestSession(t, client, "user-1")
+
+	_, err := client.RequestWorkshop(context.Background(), testEnvironment, &educatesrestapi.RequestWorkshopOptions{
+		IndexURL: testIndexURL,
+		User:     "user-2",
+	})
+
+	if !errors.Is(err, educatesrestapi.ErrNoSessionAvailable) {
+		t.Fatalf("expected ErrNoSessionAvailable, got %v", err)
+	}
+
+	// Requesting a workshop session isn't idempotent, so it must not be
+	// retried when the training portal has no capacity.
+
+	if count := server.CountRequests(http.MethodPost, "/workshops/environment/"+testEnvironment+"/request/"); count != 2 {
+		t.Errorf("expected 2 requests for workshop sessions, got %d", count)
+	}
+}
+
+func TestRetryUnavailable(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	server.InjectFault(fakeportal.Fault{
+		Method:     http.MethodGet,
+		Path:       "/workshops/catalog/environments/",
+		StatusCode: http.StatusServiceUnavailable,
+		Times:      2,
+	})
+
+	if _, err := client.ListEnvironments(context.Background(), nil); err != nil {
+		t.Fatalf("expected call to succeed once retried, got %v", err)
+	}
+
+	if count := server.CountRequests(http.MethodGet, "/workshops/catalog/environments/"); count != 3 {
+		t.Errorf("expected 3 attempts, got %d", count)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	server.InjectFault(fakeportal.Fault{
+		Method:     http.MethodGet,
+		Path:       "/workshops/catalog/environments/",
+		StatusCode: http.StatusServiceUnavailable,
+	})
+
+	_, err := client.ListEnvironments(context.Background(), nil)
+
+	if !errors.Is(err, educatesrestapi.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+
+	if count := server.CountRequests(http.MethodGet, "/workshops/catalog/environments/"); count != client.Retry.MaxAttempts {
+		t.Errorf("expected %d attempts, got %d", client.Retry.MaxAttempts, count)
+	}
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	server.InjectFault(fakeportal.Fault{
+		Method:     http.MethodPost,
+		Path:       "/workshops/environment/",
+		StatusCode: http.StatusBadGateway,
+		Times:      1,
+	})
+
+	_, err := client.RequestWorkshop(context.Background(), testEnvironment, &educatesrestapi.RequestWorkshopOptions{
+		IndexURL: testIndexURL,
+		User:     "user-1",
+	})
+
+	if err == nil {
+		t.Fatal("expected request for workshop session to fail")
+	}
+
+	if count := server.CountRequests(http.MethodPost, "/workshops/environment/"+testEnvironment+"/request/"); count != 1 {
+		t.Errorf("expected 1 attempt, got %d", count)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	// A 429 status can be retried even where the call isn't idempotent,
+	// after the delay asked for by the training portal.
+
+	server.InjectFault(fakeportal.Fault{
+		Method:     http.MethodPost,
+		Path:       "/workshops/environment/",
+		StatusCode: http.StatusTooManyRequests,
+		RetryAfter: 1,
+		Times:      1,
+	})
+
+	started := time.Now()
+
+	requestSession(t, client, "user-1")
+
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("expected retry to wait for Retry-After of 1s, waited %s", elapsed)
+	}
+}
+
+func TestRetryAfterBeyondDeadline(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	server.InjectFault(fakeportal.Fault{
+		Method:     http.MethodGet,
+		Path:       "/workshops/catalog/environments/",
+		StatusCode: http.StatusServiceUnavailable,
+		RetryAfter: 60,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	started := time.Now()
+
+	_, err := client.ListEnvironments(ctx, nil)
+
+	if !errors.Is(err, educatesrestapi.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed >= time.Second {
+		t.Errorf("expected call to give up straight away, took %s", elapsed)
+	}
+}
+
+func TestTokenRejected(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	server.ExpireTokens()
+
+	if _, err := client.ListEnvironments(context.Background(), nil); !errors.Is(err, educatesrestapi.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden for expired access token, got %v", err)
+	}
+}
+
+func TestTokenRenewed(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	accessToken := client.AccessToken
+	renewals := 0
+
+	client.Token = func(ctx context.Context, renew bool) (string, error) {
+		if renew {
+			renewals++
+			accessToken = server.Client().AccessToken
+		}
+
+		return accessToken, nil
+	}
+
+	server.ExpireTokens()
+
+	if _, err := client.ListEnvironments(context.Background(), nil); err != nil {
+		t.Fatalf("expected call to succeed with renewed access token, got %v", err)
+	}
+
+	if renewals != 1 {
+		t.Errorf("expected access token to be renewed once, renewed %d times", renewals)
+	}
+}
+
+func TestTokenRenewalFails(t *testing.T) {
+	server := newServer(t, 0)
+	client := newClient(server)
+
+	renewals := 0
+
+	client.Token = func(ctx context.Context, renew bool) (string, error) {
+		if renew {
+			renewals++
+		}
+
+		return "invalid", nil
+	}
+
+	if _, err := client.ListEnvironments(context.Background(), nil); !errors.Is(err, educatesrestapi.ErrForbidden) {
+		t.Fatalf("expected ErrForbidden where renewed access token is also rejected, got %v", err)
+	}
+
+	if renewals != 1 {
+		t.Errorf("expected access token to be renewed only once, renewed %d times", renewals)
+	}
+}
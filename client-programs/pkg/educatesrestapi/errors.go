@@ -0,0 +1,78 @@
+package educatesrestapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Errors which can be checked for using errors.Is on the error returned from
+// calls to the training portal. An APIError matches the error corresponding
+// to its HTTP status.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrUnavailable  = errors.New("service unavailable")
+
+	// ErrNoSessionAvailable is returned when a workshop session is requested
+	// but the workshop environment has no capacity for another session.
+	ErrNoSessionAvailable = errors.New("no workshop session available")
+
+	// ErrLoginRequired is returned by calls which act on behalf of a user
+	// through the web interface of the training portal, when the user has
+	// not been logged in and anonymous access is not enabled.
+	ErrLoginRequired = errors.New("login to training portal required")
+
+	// ErrPortalNotFound is returned when the training portal resource
+	// doesn't exist in the cluster.
+	ErrPortalNotFound = errors.New("training portal not found")
+)
+
+// APIError is returned when the training portal responds to a call with an
+// HTTP status indicating an error.
+type APIError struct {
+	// Method and Path identify the call, with the path being that of the
+	// URL under the training portal.
+	Method string
+	Path   string
+
+	StatusCode int
+
+	// Message is the reason for the error given by the training portal.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("%s %s to training portal failed with status %d", e.Method, e.Path, e.StatusCode)
+
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+
+	return message
+}
+
+// Is reports whether the error matches one of the errors for an HTTP status,
+// with a 503 status due to there being no capacity for a new workshop session
+// also matching ErrNoSessionAvailable.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	case ErrNoSessionAvailable:
+		return e.StatusCode == http.StatusServiceUnavailable && e.Message == "No session available"
+	}
+
+	return false
+}
@@ -0,0 +1,673 @@
+package fakeportal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+// defaultActivationTimeout is how long a requested workshop session waits
+// to be activated if no timeout is given, as for the real training portal.
+const defaultActivationTimeout = 60 * time.Second
+
+// labelsQuery matches the names of query parameters used for filtering
+// workshop environments by label, such as "labels[name]".
+var labelsQuery = regexp.MustCompile(`^labels\[(\w+)\]$`)
+
+// handleRoot responds to requests for the home page, used to check whether
+// the training portal is ready.
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	writeMessage(w, http.StatusOK, "Training portal")
+}
+
+func (s *Server) handleCatalogEnvironments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	states := map[string]bool{}
+
+	for _, state := range query["state"] {
+		states[strings.ToUpper(state)] = true
+	}
+
+	if len(states) == 0 {
+		states[StateRunning] = true
+	}
+
+	names := query["name"]
+
+	labels := map[string]string{}
+
+	for key, values := range query {
+		if match := labelsQuery.FindStringSubmatch(key); match != nil {
+			labels[match[1]] = values[len(values)-1]
+		}
+	}
+
+	sessions := query.Get("sessions") == "true" || query.Get("sessions") == "1"
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	result := educatesrestapi.WorkshopsCatalogResponse{
+		Portal:       s.portalDetails(),
+		Environments: []educatesrestapi.EnvironmentDetails{},
+	}
+
+	for _, environment := range s.environments {
+		if !states[environment.State] {
+			continue
+		}
+
+		if len(names) != 0 && !contains(names, environment.Workshop.Name) {
+			continue
+		}
+
+		details := s.environmentDetails(environment, sessions)
+
+		if !matchLabels(details.Workshop.Labels, labels) {
+			continue
+		}
+
+		result.Environments = append(result.Environments, details)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleCatalogWorkshops(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	result := educatesrestapi.WorkshopsListResponse{
+		Portal:    s.portalDetails(),
+		Workshops: []educatesrestapi.CatalogWorkshop{},
+	}
+
+	for _, environment := range s.environments {
+		if environment.State != StateRunning {
+			continue
+		}
+
+		details := s.environmentDetails(environment, false)
+
+		result.Workshops = append(result.Workshops, educatesrestapi.CatalogWorkshop{
+			WorkshopDetails: details.Workshop,
+			Environment: educatesrestapi.EnvironmentSummary{
+				Name:      details.Name,
+				State:     details.State,
+				Duration:  details.Duration,
+				Capacity:  details.Capacity,
+				Reserved:  details.Reserved,
+				Allocated: details.Allocated,
+				Available: details.Available,
+			},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleEnvironmentStatus(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	environment := s.environment(r.PathValue("name"))
+
+	if environment == nil {
+		writeMessage(w, http.StatusForbidden, "Environment does not exist")
+		return
+	}
+
+	sessions := r.URL.Query().Get("sessions") == "true" || r.URL.Query().Get("sessions") == "1"
+
+	writeJSON(w, http.StatusOK, s.environmentDetails(environment, sessions))
+}
+
+func (s *Server) handleEnvironmentRequest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	indexUrl := strings.TrimSpace(query.Get("index_url"))
+
+	if indexUrl == "" {
+		indexUrl = strings.TrimSpace(query.Get("redirect_url"))
+	}
+
+	timeout := defaultActivationTimeout
+
+	if value := strings.TrimSpace(query.Get("timeout")); value != "" {
+		seconds, err := strconv.Atoi(value)
+
+		if err != nil {
+			writeMessage(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	var body struct {
+		Parameters []educatesrestapi.Parameter `json:"parameters"`
+	}
+
+	data, _ := io.ReadAll(r.Body)
+
+	if len(data) != 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeMessage(w, http.StatusBadRequest, "Invalid JSON request payload")
+			return
+		}
+
+		for _, parameter := range body.Parameters {
+			if parameter.Name == "" {
+				writeMessage(w, http.StatusBadRequest, "Malformed JSON request payload")
+				return
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	environment := s.environment(r.PathValue("name"))
+
+	if environment == nil {
+		writeMessage(w, http.StatusForbidden, "Environment does not exist")
+		return
+	}
+
+	if indexUrl == "" {
+		writeMessage(w, http.StatusBadRequest, "Need redirect URL for workshop index")
+		return
+	}
+
+	user := strings.TrimSpace(query.Get("user"))
+
+	if user == "" {
+		user = randomToken(32)
+	}
+
+	if user == s.Username {
+		writeMessage(w, http.StatusBadRequest, "Session requests not permitted for user")
+		return
+	}
+
+	sessionName := query.Get("session")
+
+	// Where the user already has a workshop session for the workshop
+	// environment, it is returned rather than allocating a new one.
+
+	var session *Session
+
+	for _, existing := range s.allocatedSessions(environment.Name) {
+		if existing.User == user && existing.State != StateStopping {
+			session = existing
+			break
+		}
+	}
+
+	if session != nil {
+		if session.State == StateWaiting {
+			session.Token = randomToken(32)
+			session.Expires = time.Now().Add(timeout)
+		}
+
+		if sessionName != "" && session.Name != sessionName {
+			session = nil
+		}
+	} else if sessionName == "" && environment.State == StateRunning {
+		allocated := len(s.allocatedSessions(environment.Name))
+
+		if environment.Capacity == 0 || allocated < environment.Capacity {
+			session = &Session{
+				Name:        fmt.Sprintf("%s-s%03d", environment.Name, len(s.sessions)+1),
+				Environment: environment.Name,
+				User:        user,
+				State:       StateWaiting,
+				Token:       randomToken(32),
+				IndexURL:    indexUrl,
+				Parameters:  body.Parameters,
+				Started:     time.Now(),
+				Expires:     time.Now().Add(timeout),
+			}
+
+			s.sessions = append(s.sessions, session)
+		}
+	}
+
+	if session == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "No session available"})
+		return
+	}
+
+	values := url.Values{}
+
+	values.Set("token", session.Token)
+	values.Set("index_url", indexUrl)
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"name":        session.Name,
+		"session":     session.Name,
+		"user":        session.User,
+		"url":         fmt.Sprintf("/workshops/session/%s/activate/?%s", session.Name, values.Encode()),
+		"namespace":   session.Name,
+		"workshop":    environment.Workshop.Name,
+		"environment": environment.Name,
+	})
+}
+
+// handleSession responds to requests for the page of a workshop session,
+// which activating a workshop session redirects to.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	if s.allocatedSession(r.PathValue("name")) == nil {
+		writeMessage(w, http.StatusNotFound, "")
+		return
+	}
+
+	writeMessage(w, http.StatusOK, "Workshop session")
+}
+
+func (s *Server) handleSessionActivate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	token := r.URL.Query().Get("token")
+
+	if token == "" {
+		writeMessage(w, http.StatusBadRequest, "No access token supplied")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	session := s.allocatedSession(name)
+
+	if session == nil {
+		for _, stopped := range s.sessions {
+			if stopped.Name == name && stopped.IndexURL != "" {
+				http.Redirect(w, r, withQuery(stopped.IndexURL, "notification", "session-deleted"), http.StatusFound)
+				return
+			}
+		}
+
+		writeMessage(w, http.StatusBadRequest, "Invalid session name supplied")
+		return
+	}
+
+	if session.Token != token {
+		writeMessage(w, http.StatusBadRequest, "Invalid access token for session")
+		return
+	}
+
+	if session.State == StateWaiting {
+		environment := s.environment(session.Environment)
+
+		session.Started = time.Now()
+		session.Expires = time.Time{}
+
+		if environment.Duration != 0 {
+			session.Expires = session.Started.Add(environment.Duration)
+		}
+
+		session.State = StateRunning
+
+		if environment.StartupDelay != 0 {
+			session.State = StateStarting
+			session.ready = session.Started.Add(environment.StartupDelay)
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/workshops/session/%s/", session.Name), http.StatusFound)
+}
+
+func (s *Server) handleSessionSchedule(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	session := s.allocatedSession(r.PathValue("name"))
+
+	if session == nil {
+		writeMessage(w, http.StatusNotFound, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.scheduleDetails(session, nil))
+}
+
+func (s *Server) handleSessionExtend(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	session := s.allocatedSession(r.PathValue("name"))
+
+	if session == nil {
+		writeMessage(w, http.StatusNotFound, "")
+		return
+	}
+
+	if session.State == StateStopping {
+		writeMessage(w, http.StatusBadRequest, "Session is not currently in use")
+		return
+	}
+
+	extended := false
+
+	if s.extensionPermitted(session) {
+		environment := s.environment(session.Environment)
+
+		session.Expires = session.Expires.Add(extensionDuration(environment))
+
+		if deadline := session.Started.Add(environment.Deadline); session.Expires.After(deadline) {
+			session.Expires = deadline
+		}
+
+		extended = true
+	}
+
+	writeJSON(w, http.StatusOK, s.scheduleDetails(session, &extended))
+}
+
+func (s *Server) handleSessionTerminate(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	session := s.allocatedSession(r.PathValue("name"))
+
+	if session == nil {
+		writeMessage(w, http.StatusNotFound, "")
+		return
+	}
+
+	if session.State == StateStopping {
+		writeMessage(w, http.StatusBadRequest, "Session is not currently in use")
+		return
+	}
+
+	session.State = StateStopping
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"started": timestamp(session.Started),
+		"expires": timestamp(session.Expires),
+	})
+}
+
+func (s *Server) handleUserSessions(w http.ResponseWriter, r *http.Request) {
+	user := r.PathValue("name")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	result := educatesrestapi.UserSessionsResponse{
+		User:     user,
+		Sessions: []educatesrestapi.UserSession{},
+	}
+
+	for _, environment := range s.environments {
+		for _, session := range s.allocatedSessions(environment.Name) {
+			if session.User != user {
+				continue
+			}
+
+			details := educatesrestapi.UserSession{
+				Name:        session.Name,
+				Namespace:   session.Name,
+				Workshop:    environment.Workshop.Name,
+				Environment: environment.Name,
+				Started:     timestamp(session.Started).(string),
+			}
+
+			if !session.Expires.IsZero() {
+				details.Expires = timestamp(session.Expires).(string)
+				details.Countdown = remaining(session)
+				details.Extendable = s.extensionPermitted(session)
+			}
+
+			result.Sessions = append(result.Sessions, details)
+
+			break
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// portalDetails returns the details of the training portal included in the
+// catalog. It must be called with the mutex held.
+func (s *Server) portalDetails() educatesrestapi.PortalDetails {
+	allocated := 0
+
+	for _, environment := range s.environments {
+		allocated += len(s.allocatedSessions(environment.Name))
+	}
+
+	return educatesrestapi.PortalDetails{
+		Name:   s.Name,
+		Labels: s.Labels,
+		URL:    s.URL,
+		Sessions: educatesrestapi.SessionDetails{
+			Allocated: int64(allocated),
+		},
+	}
+}
+
+// environmentDetails returns the details of the workshop environment, with
+// the workshop sessions allocated from it where sessions is set. It must be
+// called with the mutex held.
+func (s *Server) environmentDetails(environment *Environment, sessions bool) educatesrestapi.EnvironmentDetails {
+	allocated := s.allocatedSessions(environment.Name)
+
+	available := 0
+
+	if environment.Capacity != 0 {
+		available = max(environment.Capacity-len(allocated), 0)
+	}
+
+	workshop := environment.Workshop
+
+	workshop.Labels = map[string]string{}
+
+	for name, value := range s.Labels {
+		workshop.Labels[name] = value
+	}
+
+	for name, value := range environment.Workshop.Labels {
+		workshop.Labels[name] = value
+	}
+
+	details := educatesrestapi.EnvironmentDetails{
+		Name:      environment.Name,
+		State:     environment.State,
+		Duration:  int64(environment.Duration / time.Second),
+		Capacity:  int64(environment.Capacity),
+		Reserved:  int64(environment.Reserved),
+		Allocated: int64(len(allocated)),
+		Available: int64(available),
+		Workshop:  workshop,
+	}
+
+	if sessions {
+		details.Sessions = []educatesrestapi.EnvironmentSession{}
+
+		for _, session := range allocated {
+			sessionDetails := educatesrestapi.EnvironmentSession{
+				Name:      session.Name,
+				State:     session.State,
+				Namespace: session.Name,
+				User:      session.User,
+				Started:   timestamp(session.Started).(string),
+			}
+
+			if !session.Expires.IsZero() {
+				sessionDetails.Expires = timestamp(session.Expires).(string)
+				sessionDetails.Countdown = remaining(session)
+				sessionDetails.Extendable = s.extensionPermitted(session)
+			}
+
+			details.Sessions = append(details.Sessions, sessionDetails)
+		}
+	}
+
+	return details
+}
+
+// scheduleDetails returns the schedule of a workshop session, including
+// whether it was extended where extended is not nil. It must be called with
+// the mutex held.
+func (s *Server) scheduleDetails(session *Session, extended *bool) map[string]interface{} {
+	details := map[string]interface{}{
+		"status":   session.State,
+		"started":  timestamp(session.Started),
+		"expires":  timestamp(session.Expires),
+		"expiring": false,
+	}
+
+	if extended != nil {
+		details["extended"] = *extended
+	}
+
+	if !session.Expires.IsZero() {
+		environment := s.environment(session.Environment)
+
+		details["expiring"] = time.Duration(remaining(session))*time.Second < extensionThreshold(environment)
+		details["countdown"] = remaining(session)
+		details["extendable"] = s.extensionPermitted(session)
+	}
+
+	return details
+}
+
+// extensionPermitted returns whether the workshop session can be extended,
+// being where it is running and within the last period of its time where
+// extension is allowed, but not yet at its deadline. It must be called with
+// the mutex held.
+func (s *Server) extensionPermitted(session *Session) bool {
+	if session.State != StateRunning || session.Expires.IsZero() {
+		return false
+	}
+
+	environment := s.environment(session.Environment)
+
+	if !session.Expires.Before(session.Started.Add(environment.Deadline)) {
+		return false
+	}
+
+	return time.Until(session.Expires) < extensionDuration(environment)
+}
+
+// extensionThreshold returns how long before a workshop session expires that
+// it is reported as expiring.
+func extensionThreshold(environment *Environment) time.Duration {
+	return max(5*time.Minute, min(environment.Duration, 4*time.Hour)/4)
+}
+
+// extensionDuration returns how long a workshop session is extended by.
+func extensionDuration(environment *Environment) time.Duration {
+	if environment.Overtime != 0 {
+		return max(5*time.Minute, environment.Overtime)
+	}
+
+	return extensionThreshold(environment)
+}
+
+// remaining returns the number of seconds before a workshop session expires.
+func remaining(session *Session) int {
+	return max(int(time.Until(session.Expires)/time.Second), 0)
+}
+
+// timestamp formats a time the same as the training portal does in JSON
+// responses, with the zero time being null.
+func timestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func matchLabels(labels map[string]string, selector map[string]string) bool {
+	for name, value := range selector {
+		if labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func withQuery(location string, name string, value string) string {
+	target, err := url.Parse(location)
+
+	if err != nil {
+		return location
+	}
+
+	query := target.Query()
+
+	query.Set(name, value)
+
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
+
+// writeJSON writes a JSON response with the status.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeMessage writes a plain message as the response with the status, which
+// like the real training portal is given as HTML. Where the message is empty,
+// a HTML page for the status is returned instead.
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	if message == "" {
+		message = fmt.Sprintf("<h1>%s</h1>", http.StatusText(status))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	io.WriteString(w, message)
+}
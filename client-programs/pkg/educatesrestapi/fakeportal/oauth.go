@@ -0,0 +1,127 @@
+package fakeportal
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+// handleToken issues an access token for the robot account, using either its
+// username and password, or a refresh token from an earlier login. The OAuth
+// client credentials can be given using basic authentication or in the form.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.validClient(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "password":
+		if r.PostForm.Get("username") != s.Username || r.PostForm.Get("password") != s.Password {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+
+		if !s.refreshTokens[refreshToken] {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		// Refresh tokens can only be used once.
+
+		delete(s.refreshTokens, refreshToken)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.issueToken())
+}
+
+// handleRevokeToken revokes an access or refresh token. As with the real
+// training portal, revoking a token which isn't valid still succeeds.
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.validClient(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	token := r.PostForm.Get("token")
+
+	delete(s.accessTokens, token)
+	delete(s.refreshTokens, token)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validClient returns whether the request has the credentials of the OAuth
+// client. It must be called with the mutex held.
+func (s *Server) validClient(r *http.Request) bool {
+	clientId, clientSecret, ok := r.BasicAuth()
+
+	if !ok {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	return clientId == s.ClientID && clientSecret == s.ClientSecret
+}
+
+// issueToken creates a new access token and refresh token. It must be called
+// with the mutex held.
+func (s *Server) issueToken() *educatesrestapi.AuthDetails {
+	auth := &educatesrestapi.AuthDetails{
+		AccessToken:  randomToken(30),
+		ExpiresIn:    int(s.TokenLifetime / time.Second),
+		TokenType:    "Bearer",
+		Scope:        "user:info",
+		RefreshToken: randomToken(30),
+	}
+
+	s.accessTokens[auth.AccessToken] = time.Now().Add(s.TokenLifetime)
+	s.refreshTokens[auth.RefreshToken] = true
+
+	return auth
+}
+
+// authorized wraps a handler for the REST API so that it is only called if
+// the request has a valid access token. As with the real training portal, a
+// request without a valid access token is rejected with a 403 status.
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mutex.Lock()
+
+		expires, valid := s.accessTokens[token]
+
+		s.mutex.Unlock()
+
+		if !found || !valid || !time.Now().Before(expires) {
+			writeMessage(w, http.StatusForbidden, "")
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,526 @@
+/*
+Package fakeportal provides an in-process fake of the REST API of a training
+portal, for testing code which uses the educatesrestapi package, and commands
+built on it, without needing a Kubernetes cluster.
+
+The fake server implements the OAuth token and revoke endpoints, listing the
+catalog of workshop environments and workshops, the status of a workshop
+environment, requesting and activating a workshop session, getting, extending
+and terminating the schedule of a workshop session, and listing the workshop
+sessions for a user. The workshop environments and sessions of the training
+portal can be set up and inspected by the test, and faults such as error
+responses, added latency and expired tokens injected.
+
+A server is created using NewServer and stopped using Close:
+
+	server := fakeportal.NewServer()
+	defer server.Close()
+
+	server.AddEnvironment(fakeportal.Environment{
+		Name:     "lab-markdown-sample-w01",
+		Workshop: educatesrestapi.WorkshopDetails{Name: "lab-markdown-sample"},
+		Capacity: 2,
+		Duration: 30 * time.Minute,
+	})
+
+	client := server.Client()
+
+Commands which use the REST API of a training portal, such as "educates
+cluster workshop request" and "educates cluster session status", can be run
+against the fake server, rather than a training portal in a cluster, by
+setting EDUCATES_PORTAL_URL to the URL of the server, and
+EDUCATES_PORTAL_CLIENT_ID, EDUCATES_PORTAL_CLIENT_SECRET,
+EDUCATES_PORTAL_USERNAME and EDUCATES_PORTAL_PASSWORD to its credentials.
+*/
+package fakeportal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+// Default credentials for the robot account of the training portal, used
+// unless changed on the server before making requests.
+const (
+	DefaultClientID     = "robot-client-id"
+	DefaultClientSecret = "robot-client-secret"
+	DefaultUsername     = "robot@educates"
+	DefaultPassword     = "robot-password"
+)
+
+// States of a workshop environment or workshop session, as reported by the
+// training portal.
+const (
+	StateStarting = "STARTING"
+	StateWaiting  = "WAITING"
+	StateRunning  = "RUNNING"
+	StateStopping = "STOPPING"
+	StateStopped  = "STOPPED"
+)
+
+// Server is a fake training portal, listening on a local address given by
+// the URL of the embedded test server.
+type Server struct {
+	*httptest.Server
+
+	// Name and Labels are reported as the details of the training portal.
+	Name   string
+	Labels map[string]string
+
+	// ClientID, ClientSecret, Username and Password are the credentials of
+	// the robot account.
+	ClientID     string
+	ClientSecret string
+	Username     string
+	Password     string
+
+	// TokenLifetime is how long an access token is valid for.
+	TokenLifetime time.Duration
+
+	mutex         sync.Mutex
+	environments  []*Environment
+	sessions      []*Session
+	accessTokens  map[string]time.Time
+	refreshTokens map[string]bool
+	faults        []*Fault
+	requests      []Request
+}
+
+// Environment is a workshop environment of the training portal.
+type Environment struct {
+	Name     string
+	Workshop educatesrestapi.WorkshopDetails
+
+	// State defaults to StateRunning. Workshop sessions can only be
+	// requested from a running workshop environment.
+	State string
+
+	// Capacity is the maximum number of workshop sessions which can be
+	// allocated, with zero meaning there is no limit.
+	Capacity int
+	Reserved int
+
+	// Duration is how long a workshop session runs for once activated,
+	// with zero meaning it doesn't expire. A workshop session can be
+	// extended by Overtime at a time, up to Deadline since it started. If
+	// Overtime is zero, the extension is a quarter of the duration, but no
+	// less than five minutes. If Deadline is zero, workshop sessions can't
+	// be extended.
+	Duration time.Duration
+	Overtime time.Duration
+	Deadline time.Duration
+
+	// StartupDelay is how long a workshop session is starting for after
+	// being activated, before it is running.
+	StartupDelay time.Duration
+}
+
+// Session is a workshop session allocated from a workshop environment.
+type Session struct {
+	Name        string
+	Environment string
+	User        string
+
+	// State is StateWaiting until the workshop session is activated, then
+	// StateStarting for the startup delay of the workshop environment,
+	// before being StateRunning.
+	State string
+
+	// Token is the token needed to activate the workshop session.
+	Token string
+
+	IndexURL   string
+	Parameters []educatesrestapi.Parameter
+
+	Started time.Time
+	Expires time.Time
+
+	// ready is when a starting workshop session is running.
+	ready time.Time
+}
+
+// Request records a request made against the server.
+type Request struct {
+	Method string
+	Path   string
+}
+
+// NewServer starts and returns a fake training portal with no workshop
+// environments. The server should be closed when done with.
+func NewServer() *Server {
+	s := &Server{
+		Name:          "educates-cli",
+		Labels:        map[string]string{},
+		ClientID:      DefaultClientID,
+		ClientSecret:  DefaultClientSecret,
+		Username:      DefaultUsername,
+		Password:      DefaultPassword,
+		TokenLifetime: time.Hour,
+		accessTokens:  map[string]time.Time{},
+		refreshTokens: map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{$}", s.handleRoot)
+
+	mux.HandleFunc("POST /oauth2/token/", s.handleToken)
+	mux.HandleFunc("POST /oauth2/revoke-token/", s.handleRevokeToken)
+
+	mux.HandleFunc("GET /workshops/catalog/environments/", s.authorized(s.handleCatalogEnvironments))
+	mux.HandleFunc("GET /workshops/catalog/workshops/", s.authorized(s.handleCatalogWorkshops))
+
+	mux.HandleFunc("GET /workshops/environment/{name}/status/", s.authorized(s.handleEnvironmentStatus))
+	mux.HandleFunc("GET /workshops/environment/{name}/request/", s.authorized(s.handleEnvironmentRequest))
+	mux.HandleFunc("POST /workshops/environment/{name}/request/", s.authorized(s.handleEnvironmentRequest))
+
+	mux.HandleFunc("GET /workshops/session/{name}/{$}", s.handleSession)
+	mux.HandleFunc("GET /workshops/session/{name}/activate/", s.handleSessionActivate)
+	mux.HandleFunc("GET /workshops/session/{name}/schedule/", s.authorized(s.handleSessionSchedule))
+	mux.HandleFunc("GET /workshops/session/{name}/extend/", s.authorized(s.handleSessionExtend))
+	mux.HandleFunc("GET /workshops/session/{name}/terminate/", s.authorized(s.handleSessionTerminate))
+
+	mux.HandleFunc("GET /workshops/user/{name}/sessions/", s.authorized(s.handleUserSessions))
+
+	s.Server = httptest.NewServer(s.injectFaults(mux))
+
+	return s
+}
+
+// Client returns a client for the REST API of the training portal, with an
+// access token for the robot account.
+func (s *Server) Client() *educatesrestapi.PortalClient {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return educatesrestapi.NewPortalClient(s.URL, s.issueToken().AccessToken)
+}
+
+// AddEnvironment adds a workshop environment to the training portal,
+// replacing any existing one of the same name.
+func (s *Server) AddEnvironment(environment Environment) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if environment.State == "" {
+		environment.State = StateRunning
+	}
+
+	if environment.Workshop.Labels == nil {
+		environment.Workshop.Labels = map[string]string{}
+	}
+
+	for i, existing := range s.environments {
+		if existing.Name == environment.Name {
+			s.environments[i] = &environment
+			return
+		}
+	}
+
+	s.environments = append(s.environments, &environment)
+}
+
+// SetEnvironmentState changes the state of a workshop environment, returning
+// false if it doesn't exist.
+func (s *Server) SetEnvironmentState(name string, state string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	environment := s.environment(name)
+
+	if environment == nil {
+		return false
+	}
+
+	environment.State = state
+
+	return true
+}
+
+// Sessions returns a copy of the workshop sessions of the training portal,
+// including those which have stopped.
+func (s *Server) Sessions() []Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	sessions := make([]Session, 0, len(s.sessions))
+
+	for _, session := range s.sessions {
+		sessions = append(sessions, *session)
+	}
+
+	return sessions
+}
+
+// Session returns a copy of the workshop session with the name.
+func (s *Server) Session(name string) (Session, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	for _, session := range s.sessions {
+		if session.Name == name {
+			return *session, true
+		}
+	}
+
+	return Session{}, false
+}
+
+// SetSessionState changes the state of a workshop session, returning false
+// if it doesn't exist.
+func (s *Server) SetSessionState(name string, state string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.update()
+
+	session := s.allocatedSession(name)
+
+	if session == nil {
+		return false
+	}
+
+	session.State = state
+	session.ready = time.Time{}
+
+	return true
+}
+
+// ExpireSession makes a workshop session expire now, as if its time had run
+// out, returning false if it doesn't exist.
+func (s *Server) ExpireSession(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session := s.allocatedSession(name)
+
+	if session == nil {
+		return false
+	}
+
+	session.Expires = time.Now()
+
+	s.update()
+
+	return true
+}
+
+// ExpireTokens makes all access tokens issued so far expire, so that they are
+// rejected. Refresh tokens remain valid.
+func (s *Server) ExpireTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for token := range s.accessTokens {
+		s.accessTokens[token] = time.Now()
+	}
+}
+
+// Requests returns the requests made against the server so far, in the order
+// they were received.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// CountRequests returns how many requests have been made using the method
+// against the path, with an empty method matching any method.
+func (s *Server) CountRequests(method string, path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+
+	for _, request := range s.requests {
+		if (method == "" || request.Method == method) && request.Path == path {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Fault is an error or delay injected into the responses of the server.
+type Fault struct {
+	// Method and Path select the requests the fault applies to, with the
+	// path being a prefix of the path of the request, such as
+	// "/workshops/session/". An empty method or path matches any request.
+	Method string
+	Path   string
+
+	// Latency is how long to delay the response by.
+	Latency time.Duration
+
+	// StatusCode, if not zero, is the status of the response returned in
+	// place of the real response, with Message as the body. If RetryAfter
+	// is not zero, it is returned as the number of seconds in the
+	// Retry-After header.
+	StatusCode int
+	Message    string
+	RetryAfter int
+
+	// Times is how many requests the fault applies to, with zero meaning it
+	// applies until the faults are cleared.
+	Times int
+}
+
+// InjectFault adds a fault to be applied to matching requests. Where more
+// than one fault matches a request, the first one added is applied.
+func (s *Server) InjectFault(fault Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.faults = nil
+}
+
+// injectFaults records each request and then applies the first fault which
+// matches it, before passing the request on to the handler if the fault
+// doesn't replace the response.
+func (s *Server) injectFaults(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path})
+
+		var fault Fault
+
+		for i, f := range s.faults {
+			if (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.Path) {
+				fault = *f
+
+				if f.Times != 0 {
+					f.Times--
+
+					if f.Times == 0 {
+						s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+					}
+				}
+
+				break
+			}
+		}
+
+		s.mutex.Unlock()
+
+		if fault.Latency != 0 {
+			if sleep(r.Context(), fault.Latency) != nil {
+				return
+			}
+		}
+
+		if fault.StatusCode != 0 {
+			if fault.RetryAfter != 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+			}
+
+			writeMessage(w, fault.StatusCode, fault.Message)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// update moves workshop sessions on to their next state where the time for
+// doing so has passed. It must be called with the mutex held.
+func (s *Server) update() {
+	now := time.Now()
+
+	for _, session := range s.sessions {
+		switch {
+		case session.State == StateStopping:
+			session.State = StateStopped
+		case session.State == StateStopped:
+		case !session.Expires.IsZero() && !now.Before(session.Expires):
+			session.State = StateStopped
+		case session.State == StateStarting && !session.ready.IsZero() && !now.Before(session.ready):
+			session.State = StateRunning
+			session.ready = time.Time{}
+		}
+	}
+}
+
+// environment returns the workshop environment with the name, or nil if it
+// doesn't exist. It must be called with the mutex held.
+func (s *Server) environment(name string) *Environment {
+	for _, environment := range s.environments {
+		if environment.Name == name {
+			return environment
+		}
+	}
+
+	return nil
+}
+
+// allocatedSession returns the workshop session with the name where it has
+// not stopped, or nil otherwise. It must be called with the mutex held.
+func (s *Server) allocatedSession(name string) *Session {
+	for _, session := range s.sessions {
+		if session.Name == name && session.State != StateStopped {
+			return session
+		}
+	}
+
+	return nil
+}
+
+// allocatedSessions returns the workshop sessions allocated from the
+// workshop environment. It must be called with the mutex held.
+func (s *Server) allocatedSessions(environment string) []*Session {
+	var sessions []*Session
+
+	for _, session := range s.sessions {
+		if session.Environment == environment && session.State != StateStopped {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+
+	return sessions
+}
+
+func randomToken(length int) string {
+	data := make([]byte, length/2)
+
+	rand.Read(data)
+
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,187 @@
+package educatesrestapi
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout is how long a call to the training portal made using a
+// client from NewPortalClient is allowed to take, including any retries.
+const DefaultTimeout = 2 * time.Minute
+
+// RetryPolicy controls how calls to the training portal are retried when they
+// fail in a way which may only be temporary, such as when the training portal
+// is still starting up and responds with a 503 status, or is not yet accepting
+// connections. The zero value means calls are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a call is made, including the first.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry, doubling for each
+	// retry after that up to MaxBackoff. Jitter is added to the delay, so
+	// that clients started at the same time don't all retry together.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy for a client from NewPortalClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// tokenRetryPolicy is the retry policy for requesting an access token. The
+// training portal may still be starting up when it is first logged into after
+// being created, so attempts are spread over around half a minute.
+var tokenRetryPolicy = RetryPolicy{
+	MaxAttempts: 6,
+	MinBackoff:  2 * time.Second,
+	MaxBackoff:  10 * time.Second,
+}
+
+// run makes a call by calling send until the response is one which should
+// not be retried, or the number of attempts has been used up. Where the call
+// is not idempotent, it is only retried if the request could not have been
+// acted on, being where the connection could not be made, or where the
+// training portal asked for it to be retried later with a 429 status.
+func (p RetryPolicy) run(ctx context.Context, idempotent bool, send func() (*http.Response, error)) (*http.Response, error) {
+	return p.runWith(ctx, func(res *http.Response, err error) bool {
+		return retryable(ctx, idempotent, res, err)
+	}, send)
+}
+
+// runWith makes a call by calling send until shouldRetry returns false for
+// the response or error, or the number of attempts has been used up.
+func (p RetryPolicy) runWith(ctx context.Context, shouldRetry func(*http.Response, error) bool, send func() (*http.Response, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := send()
+
+		if attempt >= p.MaxAttempts || !shouldRetry(res, err) {
+			return res, err
+		}
+
+		delay := p.backoff(attempt)
+
+		if res != nil {
+			if after, ok := retryAfter(res); ok {
+				delay = after
+			}
+		}
+
+		// Give up straight away if the context would be done before the
+		// call is retried, reporting why the last attempt failed.
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+			res.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "cannot connect to training portal")
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before making the attempt after the given one,
+// being between half and all of the exponential backoff for the attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MinBackoff
+
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryable returns whether a call which failed with the given response or
+// error can be retried.
+func retryable(ctx context.Context, idempotent bool, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		if idempotent {
+			return true
+		}
+
+		var opError *net.OpError
+
+		return errors.As(err, &opError) && opError.Op == "dial"
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	return idempotent && res.StatusCode >= 500
+}
+
+// tokenRetryable returns whether a request for an access token which failed
+// with the given response or error can be retried. As the request is not
+// idempotent, it is retried as for any other such call, but also where the
+// training portal responded with a 503 status as it is not yet ready.
+func tokenRetryable(ctx context.Context, res *http.Response, err error) bool {
+	if err == nil && res.StatusCode == http.StatusServiceUnavailable {
+		return ctx.Err() == nil
+	}
+
+	return retryable(ctx, false, res, err)
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of the
+// response, which can be a number of seconds or a date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// idempotentMethod returns whether calls made using the HTTP method can be
+// safely repeated.
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,247 @@
+package educatesrestapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
+	"github.com/educates/educates-training-platform/client-programs/pkg/utils"
+)
+
+// CachedToken is an access token for a training portal saved to disk so that
+// it can be reused by later commands, instead of each logging in again.
+type CachedToken struct {
+	PortalUrl string      `json:"portalUrl"`
+	Auth      AuthDetails `json:"auth"`
+	Expires   time.Time   `json:"expires"`
+}
+
+func tokenCacheFile(portalName string) string {
+	return path.Join(utils.GetEducatesHomeDir(), "tokens", portalName+".json")
+}
+
+func readCachedToken(portalName string) *CachedToken {
+	data, err := os.ReadFile(tokenCacheFile(portalName))
+
+	if err != nil {
+		return nil
+	}
+
+	token := &CachedToken{}
+
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil
+	}
+
+	return token
+}
+
+func writeCachedToken(portalName string, token *CachedToken) error {
+	cacheFile := tokenCacheFile(portalName)
+
+	if err := os.MkdirAll(path.Dir(cacheFile), 0700); err != nil {
+		return errors.Wrapf(err, "unable to create token cache directory")
+	}
+
+	data, err := json.Marshal(token)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal access token")
+	}
+
+	// A command reading the token at the same time must never see a
+	// partial file.
+
+	if err := utils.WriteFileAtomic(cacheFile, data, 0600); err != nil {
+		return errors.Wrapf(err, "unable to write access token")
+	}
+
+	return nil
+}
+
+// LoginWithCachedToken sets the access token for the training portal, reusing
+// a token saved by an earlier command where it has not expired. An expired
+// token is refreshed, with a new login only being done if that fails. The
+// token is left valid when done with so that it can be reused. If renew is
+// set, any saved access token is not reused as is, such as where it has been
+// rejected.
+func (c *WorkshopsCatalogRequester) LoginWithCachedToken(ctx context.Context, renew bool) error {
+	credentials, err := c.lookupPortalCredentials(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// A saved token is only used if it was issued by the same training
+	// portal, as a portal of the same name may have been recreated, or be
+	// in a different cluster.
+
+	cachedToken := readCachedToken(c.portalName)
+
+	if cachedToken != nil && cachedToken.PortalUrl != c.PortalUrl {
+		cachedToken = nil
+	}
+
+	if cachedToken != nil && !renew && !utils.TokenExpired(cachedToken.Expires) {
+		c.Auth = &cachedToken.Auth
+		c.expires = cachedToken.Expires
+		return nil
+	}
+
+	issued := time.Now()
+
+	if cachedToken == nil || cachedToken.Auth.RefreshToken == "" || c.refreshLogin(ctx, credentials, cachedToken.Auth.RefreshToken) != nil {
+		if err := c.passwordLogin(ctx, credentials); err != nil {
+			return err
+		}
+	}
+
+	c.expires = issued.Add(time.Duration(c.Auth.ExpiresIn) * time.Second)
+
+	return writeCachedToken(c.portalName, &CachedToken{
+		PortalUrl: c.PortalUrl,
+		Auth:      *c.Auth,
+		Expires:   c.expires,
+	})
+}
+
+// Token returns the access token for the training portal, logging in if not
+// already done, or if the access token has expired or renew is set. It can be
+// called by a long running command each time it needs the access token, with
+// renew set if the last token was rejected.
+func (c *WorkshopsCatalogRequester) Token(ctx context.Context, renew bool) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if c.Auth == nil || renew || utils.TokenExpired(c.expires) {
+		if err := c.LoginWithCachedToken(ctx, renew); err != nil {
+			return "", err
+		}
+	}
+
+	return c.Auth.AccessToken, nil
+}
+
+// Expires returns when the current access token expires, being the zero time
+// if not logged in.
+func (c *WorkshopsCatalogRequester) Expires() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.expires
+}
+
+// Logout revokes the access and refresh tokens saved for the training portal
+// and removes them from disk. It is not an error if there are no saved tokens.
+// If the training portal no longer exists, the saved tokens are still removed.
+func (c *WorkshopsCatalogRequester) Logout(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cachedToken := readCachedToken(c.portalName)
+
+	if cachedToken != nil {
+		credentials, err := c.lookupPortalCredentials(ctx)
+
+		if err != nil && !errors.Is(err, ErrPortalNotFound) {
+			return err
+		}
+
+		// Tokens are only revoked if issued by the same training portal,
+		// as for one which has been recreated they are no longer valid.
+
+		if err == nil && cachedToken.PortalUrl == c.PortalUrl {
+			if cachedToken.Auth.RefreshToken != "" {
+				if err := revokeToken(ctx, c.PortalUrl, credentials, cachedToken.Auth.RefreshToken, "refresh_token"); err != nil {
+					return err
+				}
+			}
+
+			if err := revokeToken(ctx, c.PortalUrl, credentials, cachedToken.Auth.AccessToken, "access_token"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Remove(tokenCacheFile(c.portalName)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to remove saved access token")
+	}
+
+	c.Auth = nil
+	c.expires = time.Time{}
+
+	return nil
+}
+
+// revokeToken revokes an access or refresh token issued by the training
+// portal, with hint being the type of token.
+func revokeToken(ctx context.Context, portalUrl string, credentials *portalCredentials, token string, hint string) error {
+	form := url.Values{}
+
+	form.Add("token", token)
+	form.Add("token_type_hint", hint)
+	form.Add("client_id", credentials.clientId)
+	form.Add("client_secret", credentials.clientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/oauth2/revoke-token/", portalUrl), strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return errors.Wrapf(err, "malformed request for training portal")
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := httpclient.Client().Do(req)
+
+	if err != nil {
+		return errors.Wrapf(err, "cannot connect to training portal")
+	}
+
+	defer res.Body.Close()
+
+	// Revoking a token which is not valid, such as one which has already
+	// expired, still succeeds, so any error is a real failure.
+
+	if res.StatusCode != 200 {
+		return errors.Wrap(newAPIError("POST", "/oauth2/revoke-token/", res), "cannot revoke access token")
+	}
+
+	return nil
+}
+
+// refreshLogin requests a new access token using the refresh token from an
+// earlier login.
+func (c *WorkshopsCatalogRequester) refreshLogin(ctx context.Context, credentials *portalCredentials, refreshToken string) error {
+	form := url.Values{}
+
+	form.Add("grant_type", "refresh_token")
+	form.Add("refresh_token", refreshToken)
+
+	resBody, err := requestToken(ctx, c.PortalUrl, credentials.clientId, credentials.clientSecret, form)
+
+	if err != nil {
+		return err
+	}
+
+	auth := &AuthDetails{}
+
+	if err := json.Unmarshal(resBody, auth); err != nil {
+		return errors.Wrapf(err, "cannot decode auth details")
+	}
+
+	c.Auth = auth
+
+	return nil
+}
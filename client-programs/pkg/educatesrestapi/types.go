@@ -1,5 +1,7 @@
 package educatesrestapi
 
+import "net/url"
+
 // WorkshopCatalog
 // --------------------------------------------
 
@@ -9,12 +11,12 @@ type WorkshopsCatalogResponse struct {
 }
 
 type PortalDetails struct {
-	Name string `json:"name"`
-	// Labels     []string         `json:"labels"`
-	UID        string         `json:"uid"`
-	Generation int64          `json:"generation"`
-	URL        string         `json:"url"`
-	Sessions   SessionDetails `json:"sessions"`
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels"`
+	UID        string            `json:"uid"`
+	Generation int64             `json:"generation"`
+	URL        string            `json:"url"`
+	Sessions   SessionDetails    `json:"sessions"`
 }
 
 type SessionDetails struct {
@@ -25,28 +27,77 @@ type SessionDetails struct {
 }
 
 type WorkshopDetails struct {
-	Name        string   `json:"name"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Vendor      string   `json:"vendor"`
-	Authors     []string `json:"authors"`
-	Difficulty  string   `json:"difficulty"`
-	Duration    string   `json:"duration"`
-	Tags        []string `json:"tags"`
-	// Labels      []string `json:"labels"`
-	Logo string `json:"logo"`
-	URL  string `json:"url"`
+	Name        string            `json:"name"`
+	Resource    string            `json:"resource"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Vendor      string            `json:"vendor"`
+	Authors     []string          `json:"authors"`
+	Difficulty  string            `json:"difficulty"`
+	Duration    string            `json:"duration"`
+	Tags        []string          `json:"tags"`
+	Labels      map[string]string `json:"labels"`
+	Logo        string            `json:"logo"`
+	URL         string            `json:"url"`
 }
 
 type EnvironmentDetails struct {
-	Name      string          `json:"name"`
-	State     string          `json:"state"`
-	Duration  int64           `json:"duration"`
-	Capacity  int64           `json:"capacity"`
-	Reserved  int64           `json:"reserved"`
-	Allocated int64           `json:"allocated"`
-	Available int64           `json:"available"`
-	Workshop  WorkshopDetails `json:"workshop"`
+	Name      string               `json:"name"`
+	State     string               `json:"state"`
+	Duration  int64                `json:"duration"`
+	Capacity  int64                `json:"capacity"`
+	Reserved  int64                `json:"reserved"`
+	Allocated int64                `json:"allocated"`
+	Available int64                `json:"available"`
+	Workshop  WorkshopDetails      `json:"workshop"`
+	Sessions  []EnvironmentSession `json:"sessions,omitempty"`
+}
+
+// EnvironmentSession is a workshop session allocated from a workshop
+// environment, included when requested by a robot account.
+type EnvironmentSession struct {
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	Namespace  string `json:"namespace"`
+	User       string `json:"user"`
+	Started    string `json:"started"`
+	Expires    string `json:"expires,omitempty"`
+	Countdown  int    `json:"countdown,omitempty"`
+	Extendable bool   `json:"extendable,omitempty"`
+}
+
+// ListEnvironmentsOptions filters the workshop environments returned from the
+// catalog. States and including sessions are only honoured for robot accounts.
+type ListEnvironmentsOptions struct {
+	Names    []string
+	Labels   map[string]string
+	States   []string
+	Sessions bool
+}
+
+// WorkshopCatalogWorkshops
+// --------------------------------------------
+
+type WorkshopsListResponse struct {
+	Portal    PortalDetails     `json:"portal"`
+	Workshops []CatalogWorkshop `json:"workshops"`
+}
+
+// CatalogWorkshop is a workshop from the catalog, with a summary of the
+// running workshop environment for it.
+type CatalogWorkshop struct {
+	WorkshopDetails
+	Environment EnvironmentSummary `json:"environment"`
+}
+
+type EnvironmentSummary struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Duration  int64  `json:"duration"`
+	Capacity  int64  `json:"capacity"`
+	Reserved  int64  `json:"reserved"`
+	Allocated int64  `json:"allocated"`
+	Available int64  `json:"available"`
 }
 
 // RequestWorkshop
@@ -60,6 +111,21 @@ type Parameter struct {
 	Value string `json:"value"`
 }
 
+// RequestWorkshopOptions are the details of the user a workshop session is
+// being requested for. The index URL is required, being where the user is
+// sent when the workshop session ends.
+type RequestWorkshopOptions struct {
+	IndexURL     string
+	User         string
+	Email        string
+	FirstName    string
+	LastName     string
+	Session      string
+	AnalyticsURL string
+	Timeout      int
+	Parameters   []Parameter
+}
+
 type RequestWorkshopResponse struct {
 	Name        string `json:"name"`
 	User        string `json:"user"`
@@ -69,6 +135,18 @@ type RequestWorkshopResponse struct {
 	Namespace   string `json:"namespace"`
 }
 
+// ActivationToken returns the token from the activation URL, which needs to
+// be supplied when activating the workshop session.
+func (r *RequestWorkshopResponse) ActivationToken() string {
+	activationUrl, err := url.Parse(r.URL)
+
+	if err != nil {
+		return ""
+	}
+
+	return activationUrl.Query().Get("token")
+}
+
 // WorkshopSessionDetails
 // --------------------------------------------
 
@@ -76,7 +154,52 @@ type WorkshopSessionDetails struct {
 	Started    string `json:"started"`
 	Expires    string `json:"expires"`
 	Expiring   bool   `json:"expiring"`
+	Extended   bool   `json:"extended"`
 	Countdown  int    `json:"countdown"`
 	Extendable bool   `json:"extendable"`
 	Status     string `json:"status"`
 }
+
+// WorkshopSessionAuthorization
+// --------------------------------------------
+
+type WorkshopSessionAuthorization struct {
+	Owner string `json:"owner"`
+	User  string `json:"user"`
+	Staff bool   `json:"staff"`
+}
+
+// WorkshopSessionConfig
+// --------------------------------------------
+
+type WorkshopSessionConfig struct {
+	URL      string `json:"url"`
+	Password string `json:"password"`
+}
+
+// WorkshopSessionEvent
+// --------------------------------------------
+
+type WorkshopSessionEvent struct {
+	Name string                 `json:"name"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// UserSessions
+// --------------------------------------------
+
+type UserSessionsResponse struct {
+	User     string        `json:"user"`
+	Sessions []UserSession `json:"sessions"`
+}
+
+type UserSession struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	Workshop    string `json:"workshop"`
+	Environment string `json:"environment"`
+	Started     string `json:"started"`
+	Expires     string `json:"expires,omitempty"`
+	Countdown   int    `json:"countdown,omitempty"`
+	Extendable  bool   `json:"extendable,omitempty"`
+}
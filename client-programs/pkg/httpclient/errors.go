@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxErrorMessageLength limits how much of the body of an error response is
+// included in the message for the error.
+const maxErrorMessageLength = 200
+
+// ErrorMessage returns the reason given in the body of an error response,
+// taking it from the "error" property where the body is JSON, or from the
+// body itself otherwise. Where the body is a HTML page, such as the default
+// error page of a web framework, it is not used and the message is empty.
+func ErrorMessage(res *http.Response) string {
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+
+	if mediaType == "application/json" {
+		var details struct {
+			Error string `json:"error"`
+		}
+
+		if json.Unmarshal(data, &details) != nil {
+			return ""
+		}
+
+		return details.Error
+	}
+
+	message := strings.TrimSpace(string(data))
+
+	if strings.HasPrefix(message, "<") {
+		return ""
+	}
+
+	if len(message) > maxErrorMessageLength {
+		message = message[:maxErrorMessageLength] + "..."
+	}
+
+	return message
+}
@@ -0,0 +1,162 @@
+/*
+Package httpclient creates the HTTP clients and websocket dialers used by the
+CLI for network calls, so that they all honour proxy settings given by the
+HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables, and trust the
+same certificate authorities.
+
+As well as the system certificate authorities, any certificate authorities in
+the local secrets cache are trusted, as added using "educates local secrets
+add ca", along with any given using the global --ca-file option.
+*/
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/secrets"
+)
+
+// Options are the settings for clients which can be overridden by the user.
+type Options struct {
+	// CAFiles are files holding additional PEM encoded certificate
+	// authorities to trust.
+	CAFiles []string
+
+	// InsecureSkipTLSVerify disables verification of server certificates.
+	InsecureSkipTLSVerify bool
+}
+
+var (
+	mutex     sync.Mutex
+	options   Options
+	tlsConfig *tls.Config
+	client    *http.Client
+)
+
+// Configure sets the options used for all clients created after it is called,
+// returning an error if any of the certificate authority files can't be used.
+func Configure(o Options) error {
+	config, err := newTLSConfig(o)
+
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	options = o
+	tlsConfig = config
+	client = nil
+
+	return nil
+}
+
+// CurrentOptions returns the options set by Configure, so they can be passed
+// on to any child process which also makes network calls.
+func CurrentOptions() Options {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return options
+}
+
+func newTLSConfig(o Options) (*tls.Config, error) {
+	pool, err := x509.SystemCertPool()
+
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, certificate := range secrets.LocalCachedCertificateAuthorities() {
+		pool.AppendCertsFromPEM(certificate)
+	}
+
+	for _, name := range o.CAFiles {
+		data, err := os.ReadFile(name)
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read CA file %q", name)
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in CA file %q", name)
+		}
+	}
+
+	return &tls.Config{
+		RootCAs:            pool,
+		InsecureSkipVerify: o.InsecureSkipTLSVerify,
+		MinVersion:         tls.VersionTLS12,
+	}, nil
+}
+
+// TLSConfig returns a copy of the TLS configuration for clients. If Configure
+// has not been called, the default options are used.
+func TLSConfig() *tls.Config {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return currentTLSConfig().Clone()
+}
+
+// currentTLSConfig returns the TLS configuration for clients, creating it
+// from the default options if not configured. It must be called with the
+// mutex held.
+func currentTLSConfig() *tls.Config {
+	if tlsConfig == nil {
+		// Only reading the files given in the options can fail, and there
+		// are none by default, so the error can be ignored.
+		tlsConfig, _ = newTLSConfig(Options{})
+	}
+
+	return tlsConfig
+}
+
+// NewTransport returns a new HTTP transport with the same settings as the
+// default transport, including the proxy settings, but with the TLS
+// configuration for clients.
+func NewTransport() *http.Transport {
+	return newTransport(TLSConfig())
+}
+
+func newTransport(config *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = config
+
+	return transport
+}
+
+// Client returns the HTTP client shared by the CLI for network calls, being
+// used in place of http.DefaultClient. It has no timeout, so one should be
+// set on the context of each request where needed.
+func Client() *http.Client {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if client == nil {
+		client = &http.Client{Transport: newTransport(currentTLSConfig().Clone())}
+	}
+
+	return client
+}
+
+// NewWebsocketDialer returns a websocket dialer with the proxy settings and
+// TLS configuration for clients.
+func NewWebsocketDialer() *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  TLSConfig(),
+	}
+}
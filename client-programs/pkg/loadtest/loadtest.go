@@ -0,0 +1,299 @@
+/*
+Package loadtest measures how quickly a training portal can allocate workshop
+sessions, by requesting a number of workshop sessions concurrently through
+the REST API of the training portal on behalf of synthetic users, activating
+them, and timing how long until each is running.
+*/
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/educatesrestapi"
+)
+
+// Defaults used where the corresponding options are not set.
+const (
+	DefaultConcurrency  = 10
+	DefaultUserPrefix   = "load-test"
+	DefaultReadyTimeout = 10 * time.Minute
+	DefaultPollInterval = 2 * time.Second
+)
+
+// States reported in the schedule of a workshop session, which is ready for
+// use once running.
+const (
+	sessionRunning  = "RUNNING"
+	sessionStopping = "STOPPING"
+	sessionStopped  = "STOPPED"
+)
+
+// Options are the settings for a load test.
+type Options struct {
+	// Environment is the workshop environment to request sessions from.
+	Environment string
+
+	// Sessions is the number of workshop sessions to request.
+	Sessions int
+
+	// Concurrency limits how many workshop sessions are being requested
+	// and waited on at the same time.
+	Concurrency int
+
+	// RampUp is the time over which the starts of the requests for workshop
+	// sessions are spread evenly, with all being started at once if zero.
+	RampUp time.Duration
+
+	// UserPrefix is the prefix for the names of the synthetic users that
+	// workshop sessions are requested for, with the index of the session
+	// being appended.
+	UserPrefix string
+
+	// IndexURL is where a user is sent when their workshop session ends.
+	IndexURL string
+
+	// Parameters are passed with each request for a workshop session.
+	Parameters []educatesrestapi.Parameter
+
+	// ActivationTimeout is the time in seconds the training portal allows
+	// for a workshop session to be activated after being allocated.
+	ActivationTimeout int
+
+	// ReadyTimeout limits how long to wait for a workshop session to be
+	// running after it was requested.
+	ReadyTimeout time.Duration
+
+	// PollInterval is the time between checks of whether a workshop
+	// session is running.
+	PollInterval time.Duration
+}
+
+// Result is the outcome of requesting a single workshop session. The
+// allocation time is from the request being started until the training
+// portal returned the workshop session, and the readiness time is from the
+// request being started until the workshop session was running.
+type Result struct {
+	Index          int
+	User           string
+	Session        string
+	Started        time.Time
+	AllocationTime time.Duration
+	ReadyTime      time.Duration
+	Error          string
+	CleanupError   string
+}
+
+// Failed reports whether the workshop session could not be allocated or did
+// not become ready.
+func (r *Result) Failed() bool {
+	return r.Error != ""
+}
+
+// allocated reports whether a workshop session was allocated, so that the
+// allocation time was measured.
+func (r *Result) allocated() bool {
+	return r.Session != ""
+}
+
+// ready reports whether the workshop session was running, so that the
+// readiness time was measured.
+func (r *Result) ready() bool {
+	return r.allocated() && !r.Failed()
+}
+
+// ClientFactory returns a new client for the training portal. Each workshop
+// session uses its own client, as activating a workshop session logs the
+// client in as the user the workshop session was allocated to. It is called
+// concurrently, including while other clients are renewing the access token.
+type ClientFactory func() *educatesrestapi.PortalClient
+
+// Run runs a load test, returning the results for each workshop session in
+// the order they were requested. If the context is cancelled, no further
+// workshop sessions are requested, but those already allocated are still
+// terminated. Workshop sessions are terminated once all requests have
+// finished, with any error in doing so recorded against the result.
+func Run(ctx context.Context, newClient ClientFactory, options Options) ([]Result, error) {
+	if options.Environment == "" {
+		return nil, errors.New("workshop environment is required for load test")
+	}
+
+	if options.Sessions <= 0 {
+		return nil, errors.New("number of workshop sessions must be greater than zero")
+	}
+
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultConcurrency
+	}
+
+	if options.UserPrefix == "" {
+		options.UserPrefix = DefaultUserPrefix
+	}
+
+	if options.ReadyTimeout <= 0 {
+		options.ReadyTimeout = DefaultReadyTimeout
+	}
+
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultPollInterval
+	}
+
+	results := make([]Result, options.Sessions)
+
+	slots := make(chan struct{}, options.Concurrency)
+
+	var wg sync.WaitGroup
+
+	testStarted := time.Now()
+
+	for i := range results {
+		results[i] = Result{
+			Index: i,
+			User:  fmt.Sprintf("%s-%d", options.UserPrefix, i+1),
+		}
+
+		// Spread the starts of the requests over the ramp up period, but
+		// otherwise only as fast as slots become free.
+
+		if options.RampUp > 0 {
+			delay := time.Until(testStarted.Add(options.RampUp * time.Duration(i) / time.Duration(options.Sessions)))
+
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+				}
+			}
+		}
+
+		if ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case slots <- struct{}{}:
+			}
+		}
+
+		if ctx.Err() != nil {
+			results[i].Error = "load test cancelled before workshop session requested"
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(result *Result) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			requestSession(ctx, newClient(), options, result)
+		}(&results[i])
+	}
+
+	wg.Wait()
+
+	// Use a separate context for cleaning up, so that workshop sessions are
+	// still terminated where the load test was cancelled.
+
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	terminateSessions(cleanupCtx, newClient(), options.Concurrency, results)
+
+	return results, nil
+}
+
+// requestSession requests a workshop session, activates it and waits until it
+// is running, recording the times taken in the result.
+func requestSession(ctx context.Context, client *educatesrestapi.PortalClient, options Options, result *Result) {
+	result.Started = time.Now()
+
+	requestOptions := &educatesrestapi.RequestWorkshopOptions{
+		IndexURL:   options.IndexURL,
+		User:       result.User,
+		Timeout:    options.ActivationTimeout,
+		Parameters: options.Parameters,
+	}
+
+	response, err := client.RequestWorkshop(ctx, options.Environment, requestOptions)
+
+	if err != nil {
+		result.Error = errors.Wrap(err, "failed to request workshop session").Error()
+		return
+	}
+
+	result.Session = response.Name
+	result.AllocationTime = time.Since(result.Started)
+
+	// A workshop session requested through the REST API is only started
+	// once it has been activated.
+
+	if err := client.ActivateSession(ctx, response.Name, response.ActivationToken()); err != nil {
+		result.Error = errors.Wrap(err, "failed to activate workshop session").Error()
+		return
+	}
+
+	readyCtx, cancel := context.WithDeadline(ctx, result.Started.Add(options.ReadyTimeout))
+	defer cancel()
+
+	for {
+		schedule, err := client.GetSessionSchedule(readyCtx, response.Name)
+
+		if err == nil {
+			switch schedule.Status {
+			case sessionRunning:
+				result.ReadyTime = time.Since(result.Started)
+				return
+			case sessionStopping, sessionStopped:
+				result.Error = fmt.Sprintf("workshop session stopped before running, status %s", schedule.Status)
+				return
+			}
+		} else if errors.Is(err, educatesrestapi.ErrNotFound) {
+			result.Error = errors.Wrap(err, "workshop session no longer exists").Error()
+			return
+		}
+
+		select {
+		case <-readyCtx.Done():
+			if err == nil {
+				err = readyCtx.Err()
+			}
+
+			result.Error = errors.Wrap(err, "workshop session not running").Error()
+
+			return
+		case <-time.After(options.PollInterval):
+		}
+	}
+}
+
+// terminateSessions terminates the workshop sessions which were allocated,
+// recording any failure to do so against the result.
+func terminateSessions(ctx context.Context, client *educatesrestapi.PortalClient, concurrency int, results []Result) {
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i := range results {
+		if results[i].Session == "" {
+			continue
+		}
+
+		wg.Add(1)
+
+		slots <- struct{}{}
+
+		go func(result *Result) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if _, err := client.TerminateSession(ctx, result.Session); err != nil && !errors.Is(err, educatesrestapi.ErrNotFound) {
+				result.CleanupError = err.Error()
+			}
+		}(&results[i])
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,225 @@
+package loadtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Percentiles are the times taken by workshop sessions, using the nearest
+// rank method. Allocation times are for all workshop sessions which were
+// allocated, and readiness times only for those which were running.
+type Percentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// Summary is the overall outcome of a load test.
+type Summary struct {
+	Sessions        int
+	Succeeded       int
+	Failed          int
+	CleanupFailed   int
+	AllocationTimes Percentiles
+	ReadyTimes      Percentiles
+}
+
+// Summarize calculates the summary for the results of a load test.
+func Summarize(results []Result) *Summary {
+	summary := &Summary{
+		Sessions: len(results),
+	}
+
+	var allocationTimes, readyTimes []time.Duration
+
+	for _, result := range results {
+		if result.CleanupError != "" {
+			summary.CleanupFailed++
+		}
+
+		if result.Failed() {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+
+		if result.allocated() {
+			allocationTimes = append(allocationTimes, result.AllocationTime)
+		}
+
+		if result.ready() {
+			readyTimes = append(readyTimes, result.ReadyTime)
+		}
+	}
+
+	summary.AllocationTimes = percentiles(allocationTimes)
+	summary.ReadyTimes = percentiles(readyTimes)
+
+	return summary
+}
+
+func percentiles(times []time.Duration) Percentiles {
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return Percentiles{
+		P50: percentile(times, 50),
+		P95: percentile(times, 95),
+		P99: percentile(times, 99),
+	}
+}
+
+// percentile returns the percentile of the sorted times, or zero if there
+// are none.
+func percentile(times []time.Duration, p float64) time.Duration {
+	if len(times) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(times))))
+
+	return times[max(rank, 1)-1]
+}
+
+// seconds converts a duration to seconds, rounded to milliseconds, for
+// output.
+func seconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
+
+type jsonPercentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+type jsonSummary struct {
+	Sessions        int             `json:"sessions"`
+	Succeeded       int             `json:"succeeded"`
+	Failed          int             `json:"failed"`
+	CleanupFailed   int             `json:"cleanupFailed"`
+	AllocationTimes jsonPercentiles `json:"allocationSeconds"`
+	ReadyTimes      jsonPercentiles `json:"readySeconds"`
+}
+
+type jsonResult struct {
+	User              string   `json:"user"`
+	Session           string   `json:"session,omitempty"`
+	Started           string   `json:"started,omitempty"`
+	AllocationSeconds *float64 `json:"allocationSeconds,omitempty"`
+	ReadySeconds      *float64 `json:"readySeconds,omitempty"`
+	Error             string   `json:"error,omitempty"`
+	CleanupError      string   `json:"cleanupError,omitempty"`
+}
+
+func toJSONPercentiles(p Percentiles) jsonPercentiles {
+	return jsonPercentiles{
+		P50: seconds(p.P50),
+		P95: seconds(p.P95),
+		P99: seconds(p.P99),
+	}
+}
+
+// WriteJSON writes the summary and results of a load test as JSON, with
+// times given in seconds.
+func WriteJSON(w io.Writer, results []Result) error {
+	summary := Summarize(results)
+
+	output := struct {
+		Summary jsonSummary  `json:"summary"`
+		Results []jsonResult `json:"results"`
+	}{
+		Summary: jsonSummary{
+			Sessions:        summary.Sessions,
+			Succeeded:       summary.Succeeded,
+			Failed:          summary.Failed,
+			CleanupFailed:   summary.CleanupFailed,
+			AllocationTimes: toJSONPercentiles(summary.AllocationTimes),
+			ReadyTimes:      toJSONPercentiles(summary.ReadyTimes),
+		},
+		Results: []jsonResult{},
+	}
+
+	for _, result := range results {
+		item := jsonResult{
+			User:         result.User,
+			Session:      result.Session,
+			Error:        result.Error,
+			CleanupError: result.CleanupError,
+		}
+
+		if !result.Started.IsZero() {
+			item.Started = result.Started.UTC().Format(time.RFC3339Nano)
+		}
+
+		if result.allocated() {
+			allocationSeconds := seconds(result.AllocationTime)
+			item.AllocationSeconds = &allocationSeconds
+		}
+
+		if result.ready() {
+			readySeconds := seconds(result.ReadyTime)
+			item.ReadySeconds = &readySeconds
+		}
+
+		output.Results = append(output.Results, item)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(output); err != nil {
+		return errors.Wrap(err, "unable to write load test results")
+	}
+
+	return nil
+}
+
+// WriteCSV writes the results of a load test as CSV, with a row for each
+// workshop session and times given in seconds. Times are left empty where
+// the workshop session failed before they could be measured.
+func WriteCSV(w io.Writer, results []Result) error {
+	writer := csv.NewWriter(w)
+
+	writer.Write([]string{"user", "session", "started", "allocation_seconds", "ready_seconds", "error", "cleanup_error"})
+
+	for _, result := range results {
+		started, allocationSeconds, readySeconds := "", "", ""
+
+		if !result.Started.IsZero() {
+			started = result.Started.UTC().Format(time.RFC3339Nano)
+		}
+
+		if result.allocated() {
+			allocationSeconds = strconv.FormatFloat(seconds(result.AllocationTime), 'f', 3, 64)
+		}
+
+		if result.ready() {
+			readySeconds = strconv.FormatFloat(seconds(result.ReadyTime), 'f', 3, 64)
+		}
+
+		writer.Write([]string{
+			result.User,
+			result.Session,
+			started,
+			allocationSeconds,
+			readySeconds,
+			result.Error,
+			result.CleanupError,
+		})
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return errors.Wrap(err, "unable to write load test results")
+	}
+
+	return nil
+}
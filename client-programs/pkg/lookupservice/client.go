@@ -0,0 +1,281 @@
+/*
+Package lookupservice is a client for the REST API of the Educates lookup
+service, which tracks the training portals of one or more clusters and
+allocates workshop sessions from them on behalf of tenants.
+*/
+package lookupservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
+)
+
+// Client makes calls against the REST API of the lookup service, using an
+// access token obtained by logging in with the credentials of a client of the
+// lookup service.
+type Client struct {
+	// URL is the base URL of the lookup service.
+	URL string
+
+	// AccessToken is the access token returned when logging in.
+	AccessToken string
+
+	// HTTPClient is used to make requests, defaulting to the shared client
+	// for the CLI.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the lookup service at the URL, using the
+// access token to authenticate calls. The access token can be empty where
+// the client is only used to login.
+func NewClient(serviceUrl string, accessToken string) *Client {
+	return &Client{
+		URL:         strings.TrimSuffix(serviceUrl, "/"),
+		AccessToken: accessToken,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return httpclient.Client()
+}
+
+// do makes a call against the REST API. The request body, if not nil, is
+// sent as JSON, and where out is not nil the response is decoded into it.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+	requestUrl := c.URL + path
+
+	if len(query) != 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	var body io.Reader
+
+	if in != nil {
+		data, err := json.Marshal(in)
+
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal request for lookup service")
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, body)
+
+	if err != nil {
+		return errors.Wrap(err, "malformed request for lookup service")
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.AccessToken))
+	}
+
+	res, err := c.httpClient().Do(req)
+
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to lookup service")
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return newAPIError(method, path, res)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "failed to decode response from lookup service")
+	}
+
+	return nil
+}
+
+// newAPIError creates the error for a failed call from the response, with
+// the lookup service giving the reason for the error as plain text.
+func newAPIError(method string, path string, res *http.Response) *APIError {
+	return &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: res.StatusCode,
+		Message:    httpclient.ErrorMessage(res),
+	}
+}
+
+// Login logs in with the credentials of a client of the lookup service,
+// setting the access token for later calls.
+func (c *Client) Login(ctx context.Context, username string, password string) (*LoginResponse, error) {
+	result := &LoginResponse{}
+
+	request := &LoginRequest{
+		Username: username,
+		Password: password,
+	}
+
+	if err := c.do(ctx, http.MethodPost, "/auth/login", nil, request, result); err != nil {
+		return nil, err
+	}
+
+	c.AccessToken = result.AccessToken
+
+	return result, nil
+}
+
+// Logout revokes all access tokens issued to the client of the lookup
+// service, not just the one used by this client.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/auth/logout", nil, nil, nil)
+}
+
+// ListTenants returns the tenants of the lookup service, which can only be
+// requested by a client with the admin role.
+func (c *Client) ListTenants(ctx context.Context) ([]Tenant, error) {
+	result := &TenantsResponse{}
+
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tenants", nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Tenants, nil
+}
+
+// ListTenantPortals returns the training portals accessible to a tenant.
+func (c *Client) ListTenantPortals(ctx context.Context, tenantName string) ([]Portal, error) {
+	result := &PortalsResponse{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/tenants/%s/portals", url.PathEscape(tenantName)), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Portals, nil
+}
+
+// ListClusters returns the clusters known to the lookup service.
+func (c *Client) ListClusters(ctx context.Context) ([]Cluster, error) {
+	result := &ClustersResponse{}
+
+	if err := c.do(ctx, http.MethodGet, "/api/v1/clusters", nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Clusters, nil
+}
+
+// ListPortals returns the training portals of all clusters.
+func (c *Client) ListPortals(ctx context.Context) ([]Portal, error) {
+	result := &PortalsResponse{}
+
+	if err := c.do(ctx, http.MethodGet, "/api/v1/portals", nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Portals, nil
+}
+
+// ListClusterPortals returns the training portals of a cluster.
+func (c *Client) ListClusterPortals(ctx context.Context, clusterName string) ([]Portal, error) {
+	result := &PortalsResponse{}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/clusters/%s/portals", url.PathEscape(clusterName)), nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Portals, nil
+}
+
+// ListEnvironments returns the workshop environments of a training portal.
+func (c *Client) ListEnvironments(ctx context.Context, clusterName string, portalName string) ([]Environment, error) {
+	result := &EnvironmentsResponse{}
+
+	path := fmt.Sprintf("/api/v1/clusters/%s/portals/%s/environments", url.PathEscape(clusterName), url.PathEscape(portalName))
+
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Environments, nil
+}
+
+// GetEnvironment returns a workshop environment of a training portal.
+func (c *Client) GetEnvironment(ctx context.Context, clusterName string, portalName string, environmentName string) (*Environment, error) {
+	result := &Environment{}
+
+	path := fmt.Sprintf("/api/v1/clusters/%s/portals/%s/environments/%s", url.PathEscape(clusterName), url.PathEscape(portalName), url.PathEscape(environmentName))
+
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListSessions returns the workshop sessions of a workshop environment.
+func (c *Client) ListSessions(ctx context.Context, clusterName string, portalName string, environmentName string) ([]Session, error) {
+	result := &SessionsResponse{}
+
+	path := fmt.Sprintf("/api/v1/clusters/%s/portals/%s/environments/%s/sessions", url.PathEscape(clusterName), url.PathEscape(portalName), url.PathEscape(environmentName))
+
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Sessions, nil
+}
+
+// ListWorkshops returns the workshops which have a running workshop
+// environment, for any tenant if the tenant name is empty. A client with only
+// the tenant role must give the name of a tenant it is mapped to.
+func (c *Client) ListWorkshops(ctx context.Context, tenantName string) ([]Workshop, error) {
+	query := url.Values{}
+
+	if tenantName != "" {
+		query.Set("tenant", tenantName)
+	}
+
+	result := &WorkshopsResponse{}
+
+	if err := c.do(ctx, http.MethodGet, "/api/v1/workshops", query, nil, result); err != nil {
+		return nil, err
+	}
+
+	return result.Workshops, nil
+}
+
+// RequestWorkshop requests a workshop session for a tenant, from whichever
+// training portal hosting the workshop has capacity. The workshop session
+// needs to be activated by visiting the returned activation URL.
+func (c *Client) RequestWorkshop(ctx context.Context, request *WorkshopRequest) (*WorkshopSession, error) {
+	if request.TenantName == "" || request.WorkshopName == "" {
+		return nil, errors.New("tenant and workshop names are required when requesting workshop")
+	}
+
+	result := &WorkshopSession{}
+
+	if err := c.do(ctx, http.MethodPost, "/api/v1/workshops", nil, request, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
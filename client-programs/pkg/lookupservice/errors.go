@@ -0,0 +1,63 @@
+package lookupservice
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Errors which can be checked for using errors.Is on the error returned from
+// calls to the lookup service. An APIError matches the error corresponding to
+// its HTTP status.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrUnavailable  = errors.New("service unavailable")
+
+	// ErrLoginRequired is returned when there is no saved access token for
+	// the lookup service, or it has expired.
+	ErrLoginRequired = errors.New("login to lookup service required")
+)
+
+// APIError is returned when the lookup service responds to a call with an
+// HTTP status indicating an error.
+type APIError struct {
+	Method string
+	Path   string
+
+	StatusCode int
+
+	// Message is the reason for the error given by the lookup service.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("%s %s to lookup service failed with status %d", e.Method, e.Path, e.StatusCode)
+
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+
+	return message
+}
+
+// Is reports whether the error matches one of the errors for an HTTP status.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+
+	return false
+}
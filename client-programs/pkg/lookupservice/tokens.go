@@ -0,0 +1,105 @@
+package lookupservice
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/utils"
+)
+
+// CachedToken is the access token for the lookup service saved when logging
+// in, so that it can be used by later commands.
+type CachedToken struct {
+	URL         string    `json:"url"`
+	Username    string    `json:"username"`
+	AccessToken string    `json:"accessToken"`
+	Expires     time.Time `json:"expires"`
+}
+
+func tokenCacheFile() string {
+	return path.Join(utils.GetEducatesHomeDir(), "lookup", "token.json")
+}
+
+// ReadCachedToken returns the saved access token, or ErrLoginRequired if
+// there is none or it has expired.
+func ReadCachedToken() (*CachedToken, error) {
+	data, err := os.ReadFile(tokenCacheFile())
+
+	if os.IsNotExist(err) {
+		return nil, ErrLoginRequired
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read saved access token")
+	}
+
+	token := &CachedToken{}
+
+	if err := json.Unmarshal(data, token); err != nil || token.AccessToken == "" {
+		return nil, ErrLoginRequired
+	}
+
+	if utils.TokenExpired(token.Expires) {
+		return nil, errors.Wrap(ErrLoginRequired, "access token has expired")
+	}
+
+	return token, nil
+}
+
+// WriteCachedToken saves the access token, replacing any saved for a lookup
+// service before. The file is only readable by the user.
+func WriteCachedToken(token *CachedToken) error {
+	cacheFile := tokenCacheFile()
+
+	if err := os.MkdirAll(path.Dir(cacheFile), 0700); err != nil {
+		return errors.Wrapf(err, "unable to create token cache directory")
+	}
+
+	data, err := json.Marshal(token)
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to marshal access token")
+	}
+
+	// A command reading the token at the same time must never see a
+	// partial file.
+
+	if err := utils.WriteFileAtomic(cacheFile, data, 0600); err != nil {
+		return errors.Wrapf(err, "unable to write access token")
+	}
+
+	return nil
+}
+
+// RemoveCachedToken removes the saved access token. It is not an error if
+// there is none.
+func RemoveCachedToken() error {
+	if err := os.Remove(tokenCacheFile()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to remove saved access token")
+	}
+
+	return nil
+}
+
+// NewClientFromCachedToken returns a client using the saved access token. If
+// the URL is empty, the lookup service the token was saved for is used,
+// otherwise ErrLoginRequired is returned if the token was saved for a
+// different lookup service.
+func NewClientFromCachedToken(serviceUrl string) (*Client, error) {
+	token, err := ReadCachedToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if serviceUrl != "" && strings.TrimSuffix(serviceUrl, "/") != token.URL {
+		return nil, errors.Wrapf(ErrLoginRequired, "no access token for %s", serviceUrl)
+	}
+
+	return NewClient(token.URL, token.AccessToken), nil
+}
@@ -0,0 +1,145 @@
+package lookupservice
+
+// Login
+// --------------------------------------------
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// Tenants
+// --------------------------------------------
+
+type TenantsResponse struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+type Tenant struct {
+	Name    string   `json:"name"`
+	Clients []string `json:"clients"`
+}
+
+// Clusters
+// --------------------------------------------
+
+type ClustersResponse struct {
+	Clusters []Cluster `json:"clusters"`
+}
+
+type Cluster struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Portals
+// --------------------------------------------
+
+type PortalsResponse struct {
+	Portals []Portal `json:"portals"`
+}
+
+type Portal struct {
+	Name       string            `json:"name"`
+	UID        string            `json:"uid"`
+	Generation int64             `json:"generation"`
+	Labels     map[string]string `json:"labels"`
+	Cluster    string            `json:"cluster"`
+	URL        string            `json:"url"`
+	Capacity   int64             `json:"capacity"`
+	Allocated  int64             `json:"allocated"`
+	Phase      string            `json:"phase"`
+}
+
+// Environments
+// --------------------------------------------
+
+type EnvironmentsResponse struct {
+	Environments []Environment `json:"environments"`
+}
+
+type Environment struct {
+	Name        string            `json:"name"`
+	UID         string            `json:"uid"`
+	Generation  int64             `json:"generation"`
+	Workshop    string            `json:"workshop"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+	Cluster     string            `json:"cluster"`
+	Portal      string            `json:"portal"`
+	Capacity    int64             `json:"capacity"`
+	Reserved    int64             `json:"reserved"`
+	Allocated   int64             `json:"allocated"`
+	Available   int64             `json:"available"`
+	Phase       string            `json:"phase"`
+}
+
+// Sessions
+// --------------------------------------------
+
+type SessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+type Session struct {
+	Name        string `json:"name"`
+	Generation  int64  `json:"generation"`
+	Cluster     string `json:"cluster"`
+	Portal      string `json:"portal"`
+	Environment string `json:"environment"`
+	Workshop    string `json:"workshop"`
+	Phase       string `json:"phase"`
+	User        string `json:"user"`
+}
+
+// Workshops
+// --------------------------------------------
+
+type WorkshopsResponse struct {
+	Workshops []Workshop `json:"workshops"`
+}
+
+type Workshop struct {
+	Name        string            `json:"name"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// WorkshopRequest is a request for a workshop session, with the tenant and
+// workshop being required. Where a user ID is given and the user already has
+// a workshop session for the workshop, that session is returned.
+type WorkshopRequest struct {
+	TenantName          string      `json:"tenantName"`
+	WorkshopName        string      `json:"workshopName"`
+	ClientUserId        string      `json:"clientUserId,omitempty"`
+	ClientActionId      string      `json:"clientActionId,omitempty"`
+	ClientIndexUrl      string      `json:"clientIndexUrl,omitempty"`
+	UserEmailAddress    string      `json:"userEmailAddress,omitempty"`
+	UserFirstName       string      `json:"userFirstName,omitempty"`
+	UserLastName        string      `json:"userLastName,omitempty"`
+	WorkshopParams      []Parameter `json:"workshopParams,omitempty"`
+	AnalyticsWebhookUrl string      `json:"analyticsWebhookUrl,omitempty"`
+}
+
+type Parameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type WorkshopSession struct {
+	TenantName           string `json:"tenantName"`
+	ClusterName          string `json:"clusterName"`
+	PortalName           string `json:"portalName"`
+	EnvironmentName      string `json:"environmentName"`
+	SessionName          string `json:"sessionName"`
+	ClientUserId         string `json:"clientUserId"`
+	SessionActivationUrl string `json:"sessionActivationUrl"`
+}
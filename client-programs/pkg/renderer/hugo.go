@@ -25,6 +25,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/educates/educates-training-platform/client-programs/pkg/cluster"
+	"github.com/educates/educates-training-platform/client-programs/pkg/httpclient"
 	"gopkg.in/yaml.v2"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -170,7 +171,7 @@ func fetchSessionVariables(sessionURL string, password string) (map[string]strin
 	q.Add("token", password)
 	req.URL.RawQuery = q.Encode()
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpclient.Client().Do(req)
 
 	if err != nil {
 		return params, errors.Wrapf(err, "cannot query workshop session config")
@@ -104,6 +104,41 @@ func LocalCachedSecretForCertificateAuthority(domain string) string {
 	return ""
 }
 
+/**
+ * LocalCachedCertificateAuthorities returns the PEM encoded CA certificates
+ * held in the local cache, for any domain.
+ */
+func LocalCachedCertificateAuthorities() [][]byte {
+	files, err := os.ReadDir(secretsCacheDir)
+
+	if err != nil {
+		return nil
+	}
+
+	var certificates [][]byte
+
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".yaml") {
+			secretObj, err := decodeFileIntoSecret(f.Name())
+			if err != nil {
+				continue
+			}
+
+			// Type of secret needs to be Opaque.
+			if secretObj.Type != "Opaque" && secretObj.Type != "" {
+				continue
+			}
+
+			// Needs contain ca.crt data.
+			if value, exists := secretObj.Data["ca.crt"]; exists && len(value) != 0 {
+				certificates = append(certificates, value)
+			}
+		}
+	}
+
+	return certificates
+}
+
 /**
  * SyncSecretsToCluster copies secrets from the local cache to the cluster.
  */
@@ -0,0 +1,268 @@
+package sshconfig
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/educates/educates-training-platform/client-programs/pkg/utils"
+)
+
+// The host entries for workshop sessions are kept in a separate config file
+// which is included from the main SSH config file of the user, so that the
+// user's own config is never rewritten other than to add the include.
+
+const includeDirective = "Include educates/config"
+
+const (
+	beginMarker = "# BEGIN educates session "
+	endMarker   = "# END educates session "
+)
+
+// Entry is the host entry for accessing a workshop session over SSH.
+type Entry struct {
+	Portal  string
+	Session string
+	Host    string
+	Block   string
+}
+
+func (e *Entry) key() string {
+	return e.Portal + "/" + e.Session
+}
+
+// Config locates the SSH config files of the user.
+type Config struct {
+	SSHDir string
+}
+
+// NewConfig returns the SSH config of the current user.
+func NewConfig() (*Config, error) {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to determine home directory")
+	}
+
+	return &Config{SSHDir: path.Join(homeDir, ".ssh")}, nil
+}
+
+// ManagedDir is the directory holding the managed config file and the SSH
+// private keys for workshop sessions.
+func (c *Config) ManagedDir() string {
+	return path.Join(c.SSHDir, "educates")
+}
+
+// ManagedFile is the config file holding the host entries for workshop
+// sessions.
+func (c *Config) ManagedFile() string {
+	return path.Join(c.ManagedDir(), "config")
+}
+
+// KeyFile is where the SSH private key for a workshop session is saved, with
+// the file named after the hostname of the workshop session.
+func (c *Config) KeyFile(host string) string {
+	return path.Join(c.ManagedDir(), host+".key")
+}
+
+// Entries returns the host entries in the managed config file, sorted by
+// portal and session name.
+func (c *Config) Entries() ([]*Entry, error) {
+	data, err := os.ReadFile(c.ManagedFile())
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read SSH config")
+	}
+
+	var entries []*Entry
+	var current *Entry
+	var block strings.Builder
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, beginMarker):
+			portal, session, _ := strings.Cut(strings.TrimPrefix(line, beginMarker), "/")
+			current = &Entry{Portal: portal, Session: session}
+			block.Reset()
+		case current != nil && strings.HasPrefix(line, endMarker):
+			current.Block = block.String()
+			entries = append(entries, current)
+			current = nil
+		case current != nil:
+			block.WriteString(line + "\n")
+
+			fields := strings.Fields(line)
+
+			if len(fields) == 2 && strings.EqualFold(fields[0], "Host") {
+				current.Host = fields[1]
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read SSH config")
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+
+	return entries, nil
+}
+
+// AddEntry adds the host entry to the managed config file, replacing any
+// existing entry for the same workshop session, and ensures the managed
+// config file is included from the main SSH config file.
+func (c *Config) AddEntry(entry *Entry) error {
+	entries, err := c.Entries()
+
+	if err != nil {
+		return err
+	}
+
+	var updated []*Entry
+
+	for _, existing := range entries {
+		if existing.key() != entry.key() {
+			updated = append(updated, existing)
+		}
+	}
+
+	updated = append(updated, entry)
+
+	if err := c.writeEntries(updated); err != nil {
+		return err
+	}
+
+	return c.ensureInclude()
+}
+
+// RemoveEntry removes the host entry for the workshop session from the
+// managed config file, returning the entry removed, or nil if there was none.
+func (c *Config) RemoveEntry(portal string, session string) (*Entry, error) {
+	entries, err := c.Entries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []*Entry
+	var removed *Entry
+
+	for _, existing := range entries {
+		if existing.Portal == portal && existing.Session == session {
+			removed = existing
+		} else {
+			updated = append(updated, existing)
+		}
+	}
+
+	if removed == nil {
+		return nil, nil
+	}
+
+	return removed, c.writeEntries(updated)
+}
+
+func (c *Config) writeEntries(entries []*Entry) error {
+	var data bytes.Buffer
+
+	data.WriteString("# Managed by the Educates CLI, use \"educates tunnel ssh-config\" to update.\n")
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+
+	for _, entry := range entries {
+		fmt.Fprintf(&data, "\n%s%s\n", beginMarker, entry.key())
+		data.WriteString(strings.TrimRight(entry.Block, "\n") + "\n")
+		fmt.Fprintf(&data, "%s%s\n", endMarker, entry.key())
+	}
+
+	if err := os.MkdirAll(c.ManagedDir(), 0700); err != nil {
+		return errors.Wrap(err, "unable to create SSH config directory")
+	}
+
+	return utils.WriteFileAtomic(c.ManagedFile(), data.Bytes(), 0600)
+}
+
+// ensureInclude adds the include for the managed config file to the start of
+// the main SSH config file if not already present. It must come before any
+// Host or Match sections, else it would only apply to those.
+func (c *Config) ensureInclude() error {
+	configFile := path.Join(c.SSHDir, "config")
+
+	// Where the config file is a symlink, such as when managed as part of a
+	// dotfiles repository, update the file it refers to instead.
+	if target, err := filepath.EvalSymlinks(configFile); err == nil {
+		configFile = target
+	}
+
+	data, err := os.ReadFile(configFile)
+
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to read SSH config")
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == includeDirective {
+			return nil
+		}
+	}
+
+	var updated bytes.Buffer
+
+	updated.WriteString(includeDirective + "\n")
+
+	if len(data) != 0 {
+		updated.WriteString("\n")
+		updated.Write(data)
+	}
+
+	if err := os.MkdirAll(c.SSHDir, 0700); err != nil {
+		return errors.Wrap(err, "unable to create SSH config directory")
+	}
+
+	mode := os.FileMode(0600)
+
+	if info, err := os.Stat(configFile); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return utils.WriteFileAtomic(configFile, updated.Bytes(), mode)
+}
+
+// WriteKey saves the SSH private key for a workshop session.
+func (c *Config) WriteKey(host string, key []byte) error {
+	if err := os.MkdirAll(c.ManagedDir(), 0700); err != nil {
+		return errors.Wrap(err, "unable to create SSH config directory")
+	}
+
+	return utils.WriteFileAtomic(c.KeyFile(host), key, 0600)
+}
+
+// RemoveKey deletes the saved SSH private key for a workshop session.
+func (c *Config) RemoveKey(host string) error {
+	if err := os.Remove(c.KeyFile(host)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to remove SSH private key")
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package utils
+
+import "time"
+
+// TokenExpiryMargin is how long before an access token actually expires that
+// it is treated as expired, so that it is not used only to then be rejected
+// while still in flight.
+const TokenExpiryMargin = time.Minute
+
+// TokenExpired returns whether an access token which expires at the time
+// should be treated as having expired.
+func TokenExpired(expires time.Time) bool {
+	return !time.Now().Add(TokenExpiryMargin).Before(expires)
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFileAtomic replaces the file with the data by writing it to a
+// temporary file in the same directory and renaming that over the file, so
+// that anything reading the file at the same time never sees it partially
+// written. The file is given the permissions, regardless of the umask.
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmpFile, err := os.CreateTemp(path.Dir(name), path.Base(name)+".*")
+
+	if err != nil {
+		return errors.Wrapf(err, "unable to write %s", name)
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return errors.Wrapf(err, "unable to write %s", name)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrapf(err, "unable to write %s", name)
+	}
+
+	if err := os.Chmod(tmpFile.Name(), perm); err != nil {
+		return errors.Wrapf(err, "unable to write %s", name)
+	}
+
+	if err := os.Rename(tmpFile.Name(), name); err != nil {
+		return errors.Wrapf(err, "unable to write %s", name)
+	}
+
+	return nil
+}
@@ -1,10 +1,14 @@
-module main
+module github.com/educates/educates-training-platform/tunnel-manager
 
 go 1.20
 
 require (
-	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/gorilla/websocket v1.5.0
+	github.com/hashicorp/yamux v0.1.2
+	github.com/spf13/cobra v1.6.1
+)
+
+require (
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
-	github.com/spf13/cobra v1.6.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 )
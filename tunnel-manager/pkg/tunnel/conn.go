@@ -0,0 +1,251 @@
+// Package tunnel implements the client and server sides of the websocket
+// tunnel used to reach services such as SSH in a workshop session. Data is
+// carried in binary websocket frames, with no other framing, so a connection
+// to the tunnel maps to a single TCP connection made by the tunnel server.
+// Where the tunnel server supports it, a client can instead ask for several
+// streams to be multiplexed over the one connection, each mapping to a TCP
+// connection of its own, as described for MuxSubprotocol.
+//
+// A byte stream carried over the tunnel cannot be resumed once the websocket
+// connection has been lost, so reconnection applies to establishing a
+// connection: a Dialer retries failed attempts with an exponential backoff,
+// and callers which open a connection per local client, such as port
+// forwarding, get a new connection for each client. A Server provides the
+// tunnel server end, relaying connections to a TCP target.
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultPingInterval is how often a ping is sent to the tunnel server.
+	DefaultPingInterval = 30 * time.Second
+
+	// DefaultPongTimeout is how long to wait for any frame from the tunnel
+	// server after a ping before the connection is treated as lost.
+	DefaultPongTimeout = 15 * time.Second
+
+	// writeTimeout is the maximum time allowed for writing a frame.
+	writeTimeout = 30 * time.Second
+
+	// closeTimeout is how long to wait for the tunnel server to acknowledge
+	// a close frame before the underlying connection is closed anyway.
+	closeTimeout = 2 * time.Second
+)
+
+// ErrIdleTimeout is returned when a connection is closed because no data was
+// sent or received for longer than the idle timeout.
+var ErrIdleTimeout = errors.New("tunnel closed after idle timeout")
+
+// Conn is a connection over the tunnel. Reads return data from binary frames
+// sent by the tunnel server, and each write is sent as a binary frame. Pings
+// are sent in the background so that a dead connection is detected even when
+// no data is flowing.
+type Conn struct {
+	ws *websocket.Conn
+
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	idleTimeout  time.Duration
+
+	reader     io.Reader
+	writeMutex sync.Mutex
+
+	lastData atomic.Int64
+	idle     atomic.Bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newConn(ws *websocket.Conn, pingInterval time.Duration, pongTimeout time.Duration, idleTimeout time.Duration) *Conn {
+	if pingInterval <= 0 {
+		pingInterval = DefaultPingInterval
+	}
+
+	if pongTimeout <= 0 {
+		pongTimeout = DefaultPongTimeout
+	}
+
+	c := &Conn{
+		ws:           ws,
+		pingInterval: pingInterval,
+		pongTimeout:  pongTimeout,
+		idleTimeout:  idleTimeout,
+		done:         make(chan struct{}),
+	}
+
+	c.lastData.Store(time.Now().UnixNano())
+
+	c.extendReadDeadline()
+
+	ws.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
+
+	go c.keepalive()
+
+	return c
+}
+
+// extendReadDeadline allows until after the next ping has been answered for a
+// frame to be received from the tunnel server.
+func (c *Conn) extendReadDeadline() {
+	c.ws.SetReadDeadline(time.Now().Add(c.pingInterval + c.pongTimeout))
+}
+
+// keepalive sends pings at the ping interval, and closes the connection when
+// the idle timeout expires.
+func (c *Conn) keepalive() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		if c.idleTimeout > 0 && time.Since(time.Unix(0, c.lastData.Load())) > c.idleTimeout {
+			c.idle.Store(true)
+			c.Close()
+			return
+		}
+
+		if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+			return
+		}
+	}
+}
+
+// Read reads data sent by the tunnel server. It returns io.EOF when the
+// tunnel server closes the connection normally.
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			messageType, reader, err := c.ws.NextReader()
+			if err != nil {
+				return 0, c.readError(err)
+			}
+
+			c.extendReadDeadline()
+
+			if messageType != websocket.BinaryMessage {
+				c.Close()
+				return 0, fmt.Errorf("unexpected websocket frame type: %d", messageType)
+			}
+
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(p)
+
+		if err == io.EOF {
+			c.reader = nil
+			err = nil
+		}
+
+		if n > 0 {
+			c.lastData.Store(time.Now().UnixNano())
+			return n, err
+		}
+
+		if err != nil {
+			return 0, c.readError(err)
+		}
+	}
+}
+
+func (c *Conn) readError(err error) error {
+	if c.idle.Load() {
+		return ErrIdleTimeout
+	}
+
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		return io.EOF
+	}
+
+	select {
+	case <-c.done:
+		return net.ErrClosed
+	default:
+	}
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("tunnel connection lost: no response from tunnel server within %s", c.pingInterval+c.pongTimeout)
+	}
+
+	return fmt.Errorf("tunnel connection lost: %w", err)
+}
+
+// Write sends data to the tunnel server as a single binary frame.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		if c.idle.Load() {
+			return 0, ErrIdleTimeout
+		}
+		return 0, fmt.Errorf("tunnel connection lost: %w", err)
+	}
+
+	c.lastData.Store(time.Now().UnixNano())
+
+	return len(p), nil
+}
+
+// CloseWrite tells the tunnel server that no more data will be sent, by way
+// of a close frame. Data sent by the tunnel server before it acknowledges the
+// close frame can still be read.
+func (c *Conn) CloseWrite() error {
+	return c.writeClose(websocket.CloseNormalClosure, "")
+}
+
+// writeClose sends a close frame giving the reason the connection is being
+// closed, with data still able to be read until the other end acknowledges it.
+func (c *Conn) writeClose(code int, reason string) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	message := websocket.FormatCloseMessage(code, reason)
+
+	return c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+}
+
+// Close closes the connection, stopping the keepalive pings.
+func (c *Conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.ws.Close()
+	})
+
+	return err
+}
+
+// LocalAddr returns the local network address of the websocket connection.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+// RemoteAddr returns the network address of the tunnel server.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
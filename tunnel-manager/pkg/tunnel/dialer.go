@@ -0,0 +1,198 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultMinBackoff is the delay before the first retry of a failed
+	// connection attempt.
+	DefaultMinBackoff = 500 * time.Millisecond
+
+	// DefaultMaxBackoff is the limit on the delay between retries, which
+	// otherwise doubles after each failed attempt.
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Dialer opens connections to the tunnel server. Failed connection attempts
+// are retried with an exponential backoff, except when the tunnel server
+// rejects the request outright, such as when access is denied.
+type Dialer struct {
+	// URL is the "wss://*/tunnel/" URL of the tunnel server.
+	URL string
+
+	// Header holds additional headers to send with the websocket handshake.
+	// The Origin header defaults to the URL of the tunnel server.
+	Header http.Header
+
+	// Token, if set, is called before each connection attempt to get the
+	// bearer token to authenticate with. If the tunnel server rejects the
+	// token it is called again with renew set, so that a cached token which
+	// has expired or been revoked can be replaced, before trying once more.
+	Token func(ctx context.Context, renew bool) (string, error)
+
+	// Cookies are sent with the websocket handshake, such as the session
+	// cookie for an authenticated workshop session.
+	Cookies []*http.Cookie
+
+	// WebsocketDialer is used to make the websocket connection, and defaults
+	// to websocket.DefaultDialer.
+	WebsocketDialer *websocket.Dialer
+
+	// PingInterval, PongTimeout and IdleTimeout configure keepalives for
+	// connections. The ping interval and pong timeout have defaults, but
+	// there is no idle timeout if it is not set.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	IdleTimeout  time.Duration
+
+	// Retries is the number of times a failed connection attempt is retried,
+	// with a negative value meaning to retry until the context is done.
+	Retries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Logf, if set, is called to report failed attempts which will be
+	// retried.
+	Logf func(format string, args ...interface{})
+}
+
+// Dial connects to the tunnel server, retrying failed attempts.
+func (d *Dialer) Dial(ctx context.Context) (*Conn, error) {
+	conn, _, err := d.dial(ctx, nil)
+
+	return conn, err
+}
+
+// dial connects to the tunnel server, retrying failed attempts, requesting
+// one of the subprotocols if any are given. The subprotocol chosen by the
+// tunnel server is returned, which will be empty if it chose none.
+func (d *Dialer) dial(ctx context.Context, subprotocols []string) (*Conn, string, error) {
+	backoff := d.MinBackoff
+
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+
+	maxBackoff := d.MaxBackoff
+
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	renew, renewed := false, false
+
+	for attempt := 0; ; attempt++ {
+		conn, response, retryable, err := d.dialOnce(ctx, renew, subprotocols)
+
+		if err == nil {
+			return conn, response.Header.Get("Sec-WebSocket-Protocol"), nil
+		}
+
+		renew = false
+
+		// Where the token was rejected get a new one and try again straight
+		// away, but only once, as a new token being rejected as well means
+		// access has been denied.
+		if response != nil && response.StatusCode == http.StatusUnauthorized && d.Token != nil && !renewed {
+			renew, renewed = true, true
+			attempt--
+			continue
+		}
+
+		if !retryable || (d.Retries >= 0 && attempt >= d.Retries) {
+			return nil, "", err
+		}
+
+		// Add jitter so that many clients disconnected at the same time do
+		// not all retry at once.
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+		if d.Logf != nil {
+			d.Logf("%v, retrying in %s", err, delay.Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, "", err
+		case <-time.After(delay):
+		}
+
+		backoff *= 2
+
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// dialOnce makes a single connection attempt, also returning the response to
+// the handshake and whether the attempt is worth retrying if it failed.
+func (d *Dialer) dialOnce(ctx context.Context, renew bool, subprotocols []string) (*Conn, *http.Response, bool, error) {
+	dialer := d.WebsocketDialer
+
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+
+	if len(subprotocols) != 0 {
+		dialerCopy := *dialer
+		dialerCopy.Subprotocols = subprotocols
+		dialer = &dialerCopy
+	}
+
+	headers := d.Header.Clone()
+
+	if headers == nil {
+		headers = make(http.Header)
+	}
+
+	if headers.Get("Origin") == "" {
+		headers.Set("Origin", d.URL)
+	}
+
+	if d.Token != nil {
+		token, err := d.Token(ctx, renew)
+
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("unable to get token for tunnel: %w", err)
+		}
+
+		headers.Set("Authorization", "Bearer "+token)
+	}
+
+	if len(d.Cookies) != 0 {
+		// Let the standard library format the cookies into a single header,
+		// as only the name and value of each should be sent.
+		request := &http.Request{Header: headers}
+
+		for _, cookie := range d.Cookies {
+			request.AddCookie(cookie)
+		}
+	}
+
+	ws, response, err := dialer.DialContext(ctx, d.URL, headers)
+
+	if err != nil {
+		if response != nil {
+			// A response to the handshake other than a successful upgrade
+			// is only worth retrying when the failure may be temporary,
+			// such as while the workshop session is still starting.
+			retryable := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusRequestTimeout
+
+			return nil, response, retryable, fmt.Errorf("unable to connect to tunnel: %s", response.Status)
+		}
+
+		return nil, nil, ctx.Err() == nil, fmt.Errorf("unable to connect to tunnel: %w", err)
+	}
+
+	return newConn(ws, d.PingInterval, d.PongTimeout, d.IdleTimeout), response, true, nil
+}
@@ -0,0 +1,78 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// Forward accepts connections on a local listener and relays each one over
+// its own connection to the tunnel server, until the context is done or the
+// listener fails. The listener is closed on return, and connections still
+// being relayed are closed.
+func Forward(ctx context.Context, listener net.Listener, dialer *Dialer) error {
+	session := NewSession(dialer, false)
+
+	defer session.Close()
+
+	return ForwardSession(ctx, listener, session, "")
+}
+
+// ForwardSession accepts connections on a local listener and relays each one
+// over a stream opened using the session to the target, which is empty for
+// the default target of the tunnel server. Otherwise it behaves the same as
+// Forward, with the session being left open on return, so that it can be
+// shared by listeners for different targets.
+func ForwardSession(ctx context.Context, listener net.Listener, session *Session, target string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	for {
+		local, err := listener.Accept()
+
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			forwardConnection(ctx, local, session, target)
+		}()
+	}
+}
+
+func forwardConnection(ctx context.Context, local net.Conn, session *Session, target string) {
+	logf := session.logf
+
+	stream, err := session.Open(ctx, target)
+
+	if err != nil {
+		logf("Connection from %s failed: %v", local.RemoteAddr(), err)
+		local.Close()
+		return
+	}
+
+	logf("Accepted connection from %s", local.RemoteAddr())
+
+	if err := Pipe(ctx, stream, local, local); err != nil {
+		logf("Connection from %s ended: %v", local.RemoteAddr(), err)
+		return
+	}
+
+	logf("Closed connection from %s", local.RemoteAddr())
+}
@@ -0,0 +1,409 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// MuxSubprotocol is the websocket subprotocol requested by a client wanting to
+// carry several streams over the one websocket connection, multiplexed using
+// yamux framing. A tunnel server which does not support multiplexing ignores
+// the subprotocol, in which case the connection carries a single stream to
+// the default target of the tunnel server as normal.
+//
+// Each multiplexed stream starts with a request from the client giving the
+// target to connect to, as a two byte big endian length followed by the
+// "host:port" of the target, which is empty for the default target. The
+// server replies with a single status byte, zero if the connection to the
+// target was made, or otherwise one followed by a two byte big endian length
+// and error message, after which the stream is closed.
+const MuxSubprotocol = "educates-tunnel-mux.v1"
+
+// ErrMuxNotSupported is returned when opening a stream to other than the
+// default target, where the tunnel server does not support multiplexing.
+var ErrMuxNotSupported = errors.New("tunnel server does not support multiplexing, only the default target can be reached")
+
+const (
+	streamStatusOK    = 0
+	streamStatusError = 1
+)
+
+// Stream is a stream of data over the tunnel, either a websocket connection
+// of its own, or a stream multiplexed with others over a shared connection.
+type Stream interface {
+	io.ReadWriteCloser
+
+	// CloseWrite tells the other end that no more data will be sent, with
+	// data still able to be read until the other end also closes.
+	CloseWrite() error
+}
+
+// muxStream adapts a yamux stream, for which closing only shuts down the
+// sending side, to the Stream interface.
+type muxStream struct {
+	*yamux.Stream
+}
+
+func (s muxStream) CloseWrite() error {
+	return s.Stream.Close()
+}
+
+// Close closes the stream, with any read which is blocked waiting on the
+// other end to also close the stream returning straight away.
+func (s muxStream) Close() error {
+	s.Stream.SetReadDeadline(time.Now())
+
+	return s.Stream.Close()
+}
+
+func muxConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+
+	// Keepalives are already handled by websocket pings on the underlying
+	// connection, as is detecting when it has been lost.
+	config.EnableKeepAlive = false
+	config.LogOutput = io.Discard
+
+	return config
+}
+
+// Session opens streams over the tunnel. Where multiplexing is enabled and
+// the tunnel server supports it, streams share a single websocket connection,
+// which is made when the first stream is opened, and made again when needed
+// if lost. Otherwise each stream is a websocket connection of its own.
+type Session struct {
+	dialer *Dialer
+
+	mutex    sync.Mutex
+	mux      *yamux.Session
+	fallback bool
+}
+
+// NewSession returns a session which opens streams using the dialer, with
+// streams being multiplexed over a shared connection if multiplex is set.
+func NewSession(dialer *Dialer, multiplex bool) *Session {
+	return &Session{
+		dialer:   dialer,
+		fallback: !multiplex,
+	}
+}
+
+func (s *Session) logf(format string, args ...interface{}) {
+	if s.dialer.Logf != nil {
+		s.dialer.Logf(format, args...)
+	}
+}
+
+// connect returns the multiplexed session, connecting to the tunnel server
+// if not already connected. If the tunnel server does not support
+// multiplexing, no multiplexed session is returned, but the connection made
+// when finding that out is, so it can be used for a stream.
+func (s *Session) connect(ctx context.Context) (*yamux.Session, *Conn, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.fallback {
+		return nil, nil, nil
+	}
+
+	if s.mux != nil && !s.mux.IsClosed() {
+		return s.mux, nil, nil
+	}
+
+	conn, subprotocol, err := s.dialer.dial(ctx, []string{MuxSubprotocol})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if subprotocol != MuxSubprotocol {
+		s.logf("Tunnel server does not support multiplexing, using a connection per stream")
+		s.fallback = true
+		return nil, conn, nil
+	}
+
+	s.mux, err = yamux.Client(conn, muxConfig())
+
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unable to multiplex tunnel connection: %w", err)
+	}
+
+	return s.mux, nil, nil
+}
+
+// Multiplexed returns whether streams are being multiplexed over a shared
+// connection. This is only known once the first stream has been opened.
+func (s *Session) Multiplexed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.mux != nil
+}
+
+// Probe connects to the tunnel server if not already connected, returning
+// ErrMuxNotSupported if streams cannot be multiplexed, either because the
+// session was created without multiplexing or the tunnel server does not
+// support it. This allows a client which needs to reach targets other than
+// the default to fail before accepting any connections.
+func (s *Session) Probe(ctx context.Context) error {
+	mux, conn, err := s.connect(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if conn != nil {
+		conn.Close()
+	}
+
+	if mux == nil {
+		return ErrMuxNotSupported
+	}
+
+	return nil
+}
+
+// Open opens a stream to the target, given as "host:port" as reached from
+// the tunnel server, or empty for the default target of the tunnel server.
+// Targets other than the default can only be reached where multiplexing is
+// supported by the tunnel server.
+func (s *Session) Open(ctx context.Context, target string) (Stream, error) {
+	mux, conn, err := s.connect(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if mux == nil {
+		if target != "" {
+			if conn != nil {
+				conn.Close()
+			}
+			return nil, ErrMuxNotSupported
+		}
+
+		if conn != nil {
+			return conn, nil
+		}
+
+		return s.dialer.Dial(ctx)
+	}
+
+	stream, err := mux.OpenStream()
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open stream over tunnel: %w", err)
+	}
+
+	// Don't wait forever for the tunnel server to connect to the target.
+	stream.SetReadDeadline(time.Now().Add(writeTimeout))
+
+	if err := writeStreamRequest(stream, target); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("unable to open stream over tunnel: %w", err)
+	}
+
+	if err := readStreamReply(stream); err != nil {
+		muxStream{stream}.Close()
+		return nil, err
+	}
+
+	stream.SetReadDeadline(time.Time{})
+
+	return muxStream{stream}, nil
+}
+
+// Close closes the shared connection if streams are being multiplexed, which
+// also closes any streams still open.
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.mux == nil {
+		return nil
+	}
+
+	return s.mux.Close()
+}
+
+func writeStreamRequest(w io.Writer, target string) error {
+	if len(target) > 0xffff {
+		return fmt.Errorf("target address too long")
+	}
+
+	request := make([]byte, 2+len(target))
+
+	binary.BigEndian.PutUint16(request, uint16(len(target)))
+	copy(request[2:], target)
+
+	_, err := w.Write(request)
+
+	return err
+}
+
+func readStreamRequest(r io.Reader) (string, error) {
+	return readString(r)
+}
+
+// readString reads a string sent with a two byte big endian length prefix.
+func readString(r io.Reader) (string, error) {
+	var length [2]byte
+
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return "", err
+	}
+
+	value := make([]byte, binary.BigEndian.Uint16(length[:]))
+
+	if _, err := io.ReadFull(r, value); err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+func writeStreamReply(w io.Writer, err error) error {
+	if err == nil {
+		_, err := w.Write([]byte{streamStatusOK})
+		return err
+	}
+
+	message := err.Error()
+
+	if len(message) > 0xffff {
+		message = message[:0xffff]
+	}
+
+	reply := make([]byte, 3+len(message))
+
+	reply[0] = streamStatusError
+	binary.BigEndian.PutUint16(reply[1:], uint16(len(message)))
+	copy(reply[3:], message)
+
+	_, err = w.Write(reply)
+
+	return err
+}
+
+func readStreamReply(r io.Reader) error {
+	var status [1]byte
+
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return fmt.Errorf("no reply to stream request from tunnel server: %w", err)
+	}
+
+	if status[0] == streamStatusOK {
+		return nil
+	}
+
+	message, err := readString(r)
+
+	if err != nil {
+		return fmt.Errorf("stream request rejected by tunnel server")
+	}
+
+	return fmt.Errorf("stream request rejected by tunnel server: %s", message)
+}
+
+// ServeMux accepts streams multiplexed over a connection from a client which
+// requested MuxSubprotocol, calling dial to connect to the target requested
+// for each stream and relaying data between them. It returns when the
+// connection is closed or the context is done, after all streams finish.
+func ServeMux(ctx context.Context, conn io.ReadWriteCloser, dial func(ctx context.Context, target string) (net.Conn, error)) error {
+	session, err := yamux.Server(conn, muxConfig())
+
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	defer session.Close()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-session.CloseChan():
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	for {
+		stream, err := session.AcceptStream()
+
+		if err != nil {
+			if session.IsClosed() {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			serveStream(ctx, muxStream{stream}, dial)
+		}()
+	}
+}
+
+func serveStream(ctx context.Context, stream muxStream, dial func(ctx context.Context, target string) (net.Conn, error)) {
+	defer stream.Close()
+
+	target, err := readStreamRequest(stream)
+
+	if err != nil {
+		return
+	}
+
+	remote, err := dial(ctx, target)
+
+	if err != nil {
+		writeStreamReply(stream, err)
+		return
+	}
+
+	defer remote.Close()
+
+	if err := writeStreamReply(stream, nil); err != nil {
+		return
+	}
+
+	relay(stream, remote)
+}
+
+// relay copies data in both directions between a stream and a network
+// connection, passing on when one side has finished sending, until both have.
+func relay(stream Stream, conn net.Conn) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		io.Copy(conn, stream)
+
+		if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+			closer.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+
+	io.Copy(stream, conn)
+
+	stream.CloseWrite()
+
+	<-done
+}
@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Pipe copies data between a local reader and writer and a stream over the
+// tunnel, such as stdin and stdout for an SSH proxy command, closing the
+// stream when done. It returns nil when either side finishes normally,
+// and the error otherwise, such as when the tunnel connection was lost.
+//
+// When the local reader reaches EOF, the other end is told no more data will
+// be sent and data still in transit from it is delivered before returning. If
+// in implements io.Closer it is closed on return, so that the goroutine reading
+// from it is not left blocked after the tunnel has been closed.
+func Pipe(ctx context.Context, conn Stream, in io.Reader, out io.Writer) error {
+	remoteDone := make(chan error, 1)
+	localDone := make(chan error, 1)
+
+	go func() {
+		_, err := io.Copy(out, conn)
+		remoteDone <- err
+	}()
+
+	go func() {
+		_, err := io.Copy(conn, in)
+		localDone <- err
+	}()
+
+	defer func() {
+		conn.Close()
+
+		if closer, ok := in.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+
+	select {
+	case err := <-remoteDone:
+		return err
+	case err := <-localDone:
+		if err != nil {
+			return err
+		}
+
+		// Ask the tunnel server to close the connection, then wait for
+		// it to do so, or for the close timeout to expire.
+		if err := conn.CloseWrite(); err != nil {
+			return nil
+		}
+
+		select {
+		case err := <-remoteDone:
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		case <-time.After(closeTimeout):
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	case <-ctx.Done():
+		return nil
+	}
+}
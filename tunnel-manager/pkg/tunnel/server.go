@@ -0,0 +1,241 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrTargetNotAllowed is returned when a client asks for a stream to a target
+// other than the default, and the server does not allow it.
+var ErrTargetNotAllowed = errors.New("target not allowed")
+
+// Server is the tunnel server end of the websocket tunnel, relaying data
+// between each websocket connection accepted and a TCP connection it makes
+// to the target, such as the SSH daemon of a workshop session. It implements
+// http.Handler so it can be mounted at the "/tunnel/" path of a web server.
+type Server struct {
+	// Target is the "host:port" to relay connections to.
+	Target string
+
+	// Resolve, if set, is called to determine the target for a request in
+	// place of Target, such as where the target depends on the host name
+	// used to reach the tunnel server.
+	Resolve func(r *http.Request) (string, error)
+
+	// Token, if set, is the bearer token clients must supply in the
+	// Authorization header of the websocket handshake.
+	Token string
+
+	// Authenticate, if set, is called to check the request after any check
+	// against Token, with access denied if it returns an error.
+	Authenticate func(r *http.Request) error
+
+	// Multiplex enables support for clients multiplexing several streams
+	// over one connection using MuxSubprotocol.
+	Multiplex bool
+
+	// AllowTarget, if set, is called to check if a multiplexed stream to a
+	// target other than the default is allowed. If not set, streams can
+	// only be opened to the default target.
+	AllowTarget func(target string) bool
+
+	// CheckOrigin is passed through to the websocket upgrader, and defaults
+	// to requiring the Origin header, if any, to match the host.
+	CheckOrigin func(r *http.Request) bool
+
+	// PingInterval, PongTimeout and IdleTimeout configure keepalives for
+	// connections, the same as for a Dialer.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	IdleTimeout  time.Duration
+
+	// DialTimeout is how long to wait when connecting to a target, with a
+	// default of 30 seconds.
+	DialTimeout time.Duration
+
+	// Logf, if set, is called to report connections.
+	Logf func(format string, args ...interface{})
+
+	initOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	conns    sync.WaitGroup
+}
+
+func (s *Server) init() {
+	s.initOnce.Do(func() {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	})
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Close closes all connections being relayed, telling clients the server is
+// going away, and waits for them to finish. As websocket connections are
+// hijacked from the HTTP server, they are not closed when the HTTP server is
+// shut down, so this should be called after doing that.
+func (s *Server) Close() {
+	s.init()
+	s.cancel()
+	s.conns.Wait()
+}
+
+// authenticate checks the bearer token supplied by the client, and calls the
+// custom check if there is one.
+func (s *Server) authenticate(r *http.Request) error {
+	if s.Token != "" {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			return errors.New("invalid or missing bearer token")
+		}
+	}
+
+	if s.Authenticate != nil {
+		return s.Authenticate(r)
+	}
+
+	return nil
+}
+
+// ServeHTTP upgrades the request to a websocket connection and relays it to
+// the target until either end closes the connection.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.init()
+
+	if err := s.authenticate(r); err != nil {
+		s.logf("Rejected connection from %s: %v", r.RemoteAddr, err)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tunnel"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	target := s.Target
+
+	if s.Resolve != nil {
+		var err error
+
+		if target, err = s.Resolve(r); err != nil {
+			s.logf("Rejected connection from %s: %v", r.RemoteAddr, err)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: s.CheckOrigin,
+	}
+
+	if s.Multiplex {
+		upgrader.Subprotocols = []string{MuxSubprotocol}
+	}
+
+	// The upgrader replies to the client itself if the upgrade fails.
+	ws, err := upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		return
+	}
+
+	s.conns.Add(1)
+	defer s.conns.Done()
+
+	conn := newConn(ws, s.PingInterval, s.PongTimeout, s.IdleTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// When the server is closed, tell the client the connection is being
+	// closed so it is seen as ended normally rather than lost, only forcing
+	// it closed if the client doesn't acknowledge that in time.
+
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.ctx.Done():
+		}
+
+		conn.writeClose(websocket.CloseGoingAway, "tunnel server shutting down")
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(closeTimeout):
+			cancel()
+		}
+	}()
+
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	dial := func(ctx context.Context, streamTarget string) (net.Conn, error) {
+		if streamTarget == "" {
+			streamTarget = target
+		} else if s.AllowTarget == nil || !s.AllowTarget(streamTarget) {
+			return nil, fmt.Errorf("%w: %s", ErrTargetNotAllowed, streamTarget)
+		}
+
+		return s.dial(ctx, streamTarget)
+	}
+
+	if ws.Subprotocol() == MuxSubprotocol {
+		s.logf("Accepted multiplexed connection from %s", r.RemoteAddr)
+
+		if err := ServeMux(ctx, conn, dial); err != nil {
+			s.logf("Multiplexed connection from %s ended: %v", r.RemoteAddr, err)
+			return
+		}
+
+		s.logf("Closed multiplexed connection from %s", r.RemoteAddr)
+
+		return
+	}
+
+	remote, err := dial(ctx, "")
+
+	if err != nil {
+		s.logf("Connection from %s to %s failed: %v", r.RemoteAddr, target, err)
+		conn.writeClose(websocket.CloseInternalServerErr, "unable to connect to target")
+		conn.Close()
+		return
+	}
+
+	s.logf("Accepted connection from %s to %s", r.RemoteAddr, target)
+
+	if err := Pipe(ctx, conn, remote, remote); err != nil {
+		s.logf("Connection from %s to %s ended: %v", r.RemoteAddr, target, err)
+		return
+	}
+
+	s.logf("Closed connection from %s to %s", r.RemoteAddr, target)
+}
+
+func (s *Server) dial(ctx context.Context, target string) (net.Conn, error) {
+	timeout := s.DialTimeout
+
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	return dialer.DialContext(ctx, "tcp", target)
+}
@@ -0,0 +1,217 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Constants from RFC 1928 for the subset of SOCKS5 which is supported, being
+// the CONNECT command with no authentication.
+const (
+	socksVersion = 5
+
+	socksMethodNoAuth       = 0x00
+	socksMethodNoAcceptable = 0xff
+
+	socksCommandConnect = 0x01
+
+	socksAddressIPv4   = 0x01
+	socksAddressDomain = 0x03
+	socksAddressIPv6   = 0x04
+
+	socksReplySucceeded           = 0x00
+	socksReplyGeneralFailure      = 0x01
+	socksReplyCommandNotSupported = 0x07
+	socksReplyAddressNotSupported = 0x08
+)
+
+// socksHandshakeTimeout is how long a client has to make its request.
+const socksHandshakeTimeout = 30 * time.Second
+
+// ServeSOCKS accepts connections on a local listener from SOCKS5 clients, and
+// relays each one over a stream opened using the session to the address the
+// client asks to connect to, with that address being resolved and connected
+// to by the tunnel server. This requires a tunnel server which supports
+// multiplexing. It returns when the context is done or the listener fails,
+// with the listener being closed on return.
+func ServeSOCKS(ctx context.Context, listener net.Listener, session *Session) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	for {
+		local, err := listener.Accept()
+
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			serveSOCKSConnection(ctx, local, session)
+		}()
+	}
+}
+
+func serveSOCKSConnection(ctx context.Context, local net.Conn, session *Session) {
+	logf := session.logf
+
+	local.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	target, err := socksHandshake(local)
+
+	if err != nil {
+		logf("SOCKS request from %s failed: %v", local.RemoteAddr(), err)
+		local.Close()
+		return
+	}
+
+	stream, err := session.Open(ctx, target)
+
+	if err != nil {
+		logf("SOCKS connection from %s to %s failed: %v", local.RemoteAddr(), target, err)
+		writeSOCKSReply(local, socksReplyGeneralFailure)
+		local.Close()
+		return
+	}
+
+	if err := writeSOCKSReply(local, socksReplySucceeded); err != nil {
+		stream.Close()
+		local.Close()
+		return
+	}
+
+	local.SetDeadline(time.Time{})
+
+	logf("SOCKS connection from %s to %s", local.RemoteAddr(), target)
+
+	if err := Pipe(ctx, stream, local, local); err != nil {
+		logf("SOCKS connection from %s to %s ended: %v", local.RemoteAddr(), target, err)
+	}
+}
+
+// socksHandshake negotiates the authentication method with the client and
+// reads its request, returning the "host:port" address it asked to connect
+// to. Requests which are not supported are replied to before returning an
+// error.
+func socksHandshake(conn net.Conn) (string, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", err
+	}
+
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socksMethodNoAcceptable)
+
+	for _, m := range methods {
+		if m == socksMethodNoAuth {
+			method = socksMethodNoAuth
+		}
+	}
+
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+
+	if method == socksMethodNoAcceptable {
+		return "", fmt.Errorf("no supported authentication method offered")
+	}
+
+	var request [4]byte
+
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return "", err
+	}
+
+	if request[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", request[0])
+	}
+
+	if request[1] != socksCommandConnect {
+		writeSOCKSReply(conn, socksReplyCommandNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+
+	switch request[3] {
+	case socksAddressIPv4, socksAddressIPv6:
+		size := net.IPv4len
+
+		if request[3] == socksAddressIPv6 {
+			size = net.IPv6len
+		}
+
+		address := make([]byte, size)
+
+		if _, err := io.ReadFull(conn, address); err != nil {
+			return "", err
+		}
+
+		host = net.IP(address).String()
+	case socksAddressDomain:
+		var length [1]byte
+
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return "", err
+		}
+
+		domain := make([]byte, length[0])
+
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+
+		host = string(domain)
+	default:
+		writeSOCKSReply(conn, socksReplyAddressNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	var port [2]byte
+
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeSOCKSReply sends a reply to the request of the client. The bound
+// address is always given as unspecified, as the address the tunnel server
+// connected from is not known.
+func writeSOCKSReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion, reply, 0, socksAddressIPv4, 0, 0, 0, 0, 0, 0})
+
+	return err
+}
@@ -5,19 +5,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/spf13/cobra"
-)
 
-type session struct {
-	ws      *websocket.Conn
-	errChan chan error
-}
+	"github.com/educates/educates-training-platform/tunnel-manager/pkg/tunnel"
+)
 
 func main() {
 	rootCmd := &cobra.Command{
@@ -26,6 +24,11 @@ func main() {
 		Run:   root,
 	}
 
+	rootCmd.Flags().Duration("ping-interval", tunnel.DefaultPingInterval, "Interval between keepalive pings sent to the tunnel server")
+	rootCmd.Flags().Duration("idle-timeout", 0, "Close the tunnel when no data has been sent or received for this long")
+	rootCmd.Flags().Int("retries", 5, "Number of times to retry connecting to the tunnel server")
+	rootCmd.Flags().String("token", "", "Bearer token to authenticate with the tunnel server")
+
 	rootCmd.Execute()
 }
 
@@ -35,79 +38,40 @@ func root(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	dest, err := url.Parse(args[0])
-
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	pingInterval, _ := cmd.Flags().GetDuration("ping-interval")
+	idleTimeout, _ := cmd.Flags().GetDuration("idle-timeout")
+	retries, _ := cmd.Flags().GetInt("retries")
+	token, _ := cmd.Flags().GetString("token")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dialer := &tunnel.Dialer{
+		URL:          args[0],
+		PingInterval: pingInterval,
+		IdleTimeout:  idleTimeout,
+		Retries:      retries,
+		MaxBackoff:   10 * time.Second,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		},
 	}
 
-	originURL := *dest
-
-	origin := originURL.String()
-
-	headers := make(http.Header)
-	headers.Add("Origin", origin)
-
-	dialer := websocket.Dialer{}
+	if token != "" {
+		dialer.Token = func(context.Context, bool) (string, error) {
+			return token, nil
+		}
+	}
 
-	ws, _, err := dialer.Dial(origin, headers)
+	conn, err := dialer.Dial(ctx)
 
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	sess := &session{
-		ws:      ws,
-		errChan: make(chan error),
-	}
-
-	go sess.readInput()
-	go sess.readRemote()
-
-	os.Stderr.WriteString(fmt.Sprintf("%s\n", <-sess.errChan))
-}
-
-func (s *session) readInput() {
-	in := os.Stdin
-
-	const BUF_SIZE = 16384
-	bufOut := make([]byte, BUF_SIZE)
-
-	for {
-		var n int
-		var err error
-
-		if n, err = in.Read(bufOut); err != nil || n == 0 {
-			break
-		}
-
-		if err = s.ws.WriteMessage(websocket.BinaryMessage, bufOut[0:n]); err != nil {
-			break
-		}
-	}
-}
-
-func (s *session) readRemote() {
-	out := os.Stdout
-
-	for {
-		msgType, buf, err := s.ws.ReadMessage()
-
-		if err != nil {
-			s.errChan <- err
-			return
-		}
-
-		switch msgType {
-		case websocket.BinaryMessage:
-			if _, err = out.Write(buf); err != nil {
-				break
-			}
-		default:
-			s.errChan <- fmt.Errorf("unexpected websocket frame type: %d", msgType)
-			return
-		}
+	if err := tunnel.Pipe(ctx, conn, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }